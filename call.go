@@ -0,0 +1,340 @@
+package main
+
+import (
+	"errors"
+	"github.com/urfave/cli/v2"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var CallsCommand = &cli.Command{
+	Name:   "calls",
+	Usage:  "list voice and video call log",
+	Action: actionCalls,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "db",
+			Usage:   "decrypted Backup.db file path",
+			Value:   "Backup.db",
+			Aliases: []string{"d"},
+		},
+		&cli.StringFlag{
+			Name:     "resource",
+			Usage:    "BAK_0_XXX folder path",
+			Required: true,
+			Aliases:  []string{"r"},
+		},
+		&cli.StringFlag{
+			Name:    "talker",
+			Usage:   "only list talker calls default all sessions",
+			Aliases: []string{"t"},
+		},
+		&cli.StringFlag{
+			Name:     "pass",
+			Usage:    "decrypt media resource file chunk key",
+			Required: true,
+			Aliases:  []string{"p"},
+		},
+		&cli.StringFlag{
+			Name:    "format",
+			Usage:   "output format table, csv or json",
+			Value:   "table",
+			Aliases: []string{"f"},
+		},
+		&cli.StringFlag{
+			Name:    "output",
+			Usage:   "output file default stdout",
+			Aliases: []string{"o"},
+		},
+	},
+}
+
+type CallKind int
+
+const (
+	CallVideo CallKind = iota
+	CallVoice
+)
+
+func (k CallKind) String() string {
+	if k == CallVoice {
+		return "voice"
+	}
+	return "video"
+}
+
+func (k CallKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+type CallOutcome int
+
+const (
+	CallUnknown CallOutcome = iota
+	CallAnswered
+	CallCanceled
+	CallMissed
+	CallRejected
+	CallTimeout
+	// CallAborted legacy wordingtype 3, ended before connected
+	CallAborted
+)
+
+func (o CallOutcome) String() string {
+	switch o {
+	case CallAnswered:
+		return "answered"
+	case CallCanceled:
+		return "canceled"
+	case CallMissed:
+		return "missed"
+	case CallRejected:
+		return "rejected"
+	case CallTimeout:
+		return "timeout"
+	case CallAborted:
+		return "aborted"
+	}
+	return "unknown"
+}
+
+func (o CallOutcome) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// Call merged legacy voipinvitemsg and VoIPBubbleMsg type 50 message
+type Call struct {
+	MsgId  uint64
+	Talker string
+	// Caller sender of call message, empty when unknown
+	Caller    string
+	Direction Direction
+	Kind      CallKind
+	Outcome   CallOutcome
+	Start     time.Time
+	Duration  time.Duration `json:"-"`
+	RoomId    int64
+	// Text original bubble wording
+	Text string
+}
+
+type callWording struct {
+	outcome CallOutcome
+	words   []string
+}
+
+// callWordings bubble msg text, order matters "对方已取消" before "已取消"
+var callWordings = []callWording{
+	{CallAnswered, []string{"通话时长", "Duration", "Call duration"}},
+	{CallRejected, []string{"已拒绝", "Declined", "Rejected"}},
+	{CallMissed, []string{"对方已取消", "未接听", "Missed", "Caller canceled"}},
+	{CallCanceled, []string{"已取消", "Canceled", "Cancelled"}},
+	{CallTimeout, []string{"无应答", "No answer", "Unanswered"}},
+}
+
+var callDurationRegexp = regexp.MustCompile(`(?:(\d+):)?(\d{1,2}):(\d{2})`)
+
+// parseCallDuration find "mm:ss" or "hh:mm:ss" in bubble wording
+func parseCallDuration(text string) time.Duration {
+	match := callDurationRegexp.FindStringSubmatch(text)
+	if match == nil {
+		return 0
+	}
+	hours, _ := strconv.Atoi(match[1])
+	minutes, _ := strconv.Atoi(match[2])
+	seconds, _ := strconv.Atoi(match[3])
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second
+}
+
+func parseCallWording(text string) CallOutcome {
+	for i := 0; i < len(callWordings); i++ {
+		w := callWordings[i]
+		for j := 0; j < len(w.words); j++ {
+			if strings.Contains(text, w.words[j]) {
+				return w.outcome
+			}
+		}
+	}
+	return CallUnknown
+}
+
+// unixTime accept second or millisecond timestamp
+func unixTime(ts int64) time.Time {
+	if ts > 1e12 {
+		return time.UnixMilli(ts)
+	}
+	return time.Unix(ts, 0)
+}
+
+func (m *Message) Call() *Call {
+	c := &Call{
+		MsgId:     m.Id,
+		Talker:    m.Talker,
+		Caller:    m.Sender,
+		Direction: m.Direction,
+		Start:     m.Time,
+	}
+
+	switch {
+	case m.OldVoIP != nil:
+		voip := m.OldVoIP
+		c.RoomId = int64(voip.VoIPInviteMsg.RoomId)
+		if voip.VoIPInviteMsg.InviteType == 1 {
+			c.Kind = CallVoice
+		}
+		if voip.VoIPExtInfo.RecvTime > 0 {
+			c.Start = unixTime(voip.VoIPExtInfo.RecvTime)
+		}
+		switch voip.VoIPLocalInfo.WordingType {
+		case 4:
+			c.Outcome = CallAnswered
+			c.Duration = time.Duration(voip.VoIPLocalInfo.Duration) * time.Second
+		case 2:
+			c.Outcome = CallCanceled
+		case 3:
+			c.Outcome = CallAborted
+		case 1:
+			// nobody picked up, missed or timeout depend on direction
+			c.Outcome = CallTimeout
+		}
+	case m.VoIP != nil && m.VoIP.VoIPBubbleMsg != nil:
+		bubble := m.VoIP.VoIPBubbleMsg
+		c.RoomId = int64(bubble.RoomId)
+		if c.RoomId == 0 {
+			c.RoomId = bubble.InviteId64
+		}
+		if bubble.RoomType == 1 {
+			c.Kind = CallVoice
+		}
+		if bubble.Timestamp > 0 {
+			c.Start = unixTime(bubble.Timestamp)
+		}
+		c.Text = bubble.Msg
+		c.Outcome = parseCallWording(bubble.Msg)
+		if c.Outcome == CallAnswered {
+			c.Duration = time.Duration(bubble.Duration) * time.Second
+			if c.Duration == 0 {
+				c.Duration = parseCallDuration(bubble.Msg)
+			}
+		}
+	default:
+		return nil
+	}
+
+	c.resolve()
+	return c
+}
+
+// resolve nobody picked up outcome by direction, missed for incoming call
+func (c *Call) resolve() {
+	switch {
+	case c.Outcome == CallTimeout && c.Direction == Incoming:
+		c.Outcome = CallMissed
+	case c.Outcome == CallMissed && c.Direction == Outgoing:
+		c.Outcome = CallTimeout
+	}
+}
+
+type CallEntry struct {
+	*Call
+	Name    string
+	Seconds int64
+}
+
+func callEntryRow(e *CallEntry) []string {
+	return []string{
+		e.Start.Format("2006-01-02 15:04:05"),
+		e.Direction.String(),
+		e.Kind.String(),
+		e.Talker,
+		e.Name,
+		e.Outcome.String(),
+		strconv.FormatInt(e.Seconds, 10),
+		strconv.FormatInt(e.RoomId, 10),
+		strconv.FormatUint(e.MsgId, 10),
+	}
+}
+
+var callEntryHeader = []string{"Start", "Direction", "Kind", "Talker", "Name", "Outcome", "Duration", "RoomId", "MsgId"}
+
+func actionCalls(ctx *cli.Context) error {
+	dbName := ctx.String("db")
+	resource := ctx.String("resource")
+	talker := ctx.String("talker")
+	pass := Pass(ctx.String("pass"))
+	format := ctx.String("format")
+	output := ctx.String("output")
+	if !pass.Valid() {
+		return ErrInvalidPassKey
+	}
+	if format != "table" && format != "csv" && format != "json" {
+		return errors.New("unsupported format " + format)
+	}
+
+	defer releaseFds()
+
+	db, err := NewBackupDB(dbName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	book, err := NewContactBook(db)
+	if err != nil {
+		return err
+	}
+
+	talkers, err := selectTalkers(db, talker)
+	if err != nil {
+		return err
+	}
+
+	owner, err := detectOwner(db, resource, pass)
+	if err != nil {
+		return err
+	}
+
+	var calls []*Call
+	for i := 0; i < len(talkers); i++ {
+		messages, err := loadMessages(db, resource, pass, talkers[i], book, LoadOptions{Owner: owner})
+		if err != nil {
+			return err
+		}
+		for j := 0; j < len(messages); j++ {
+			if call := messages[j].Call(); call != nil {
+				calls = append(calls, call)
+			}
+		}
+	}
+
+	entries := make([]*CallEntry, 0, len(calls))
+	for i := 0; i < len(calls); i++ {
+		call := calls[i]
+		entries = append(entries, &CallEntry{
+			Call:    call,
+			Name:    book.Name(call.Talker),
+			Seconds: int64(call.Duration.Seconds()),
+		})
+	}
+
+	w, err := createOutput(output)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if format == "json" {
+		return writeJSON(w, entries)
+	}
+
+	rows := make([][]string, 0, len(entries))
+	for i := 0; i < len(entries); i++ {
+		rows = append(rows, callEntryRow(entries[i]))
+	}
+	if format == "csv" {
+		return writeCSV(w, callEntryHeader, rows)
+	}
+	return writeTable(w, callEntryHeader, rows)
+}
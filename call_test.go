@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCallDuration(t *testing.T) {
+	tests := []struct {
+		text string
+		want time.Duration
+	}{
+		{"通话时长 00:42", 42 * time.Second},
+		{"通话时长 05:07", 5*time.Minute + 7*time.Second},
+		{"Duration: 1:02:03", time.Hour + 2*time.Minute + 3*time.Second},
+		{"Call duration 12:00:00", 12 * time.Hour},
+		{"Duration 9:05", 9*time.Minute + 5*time.Second},
+		{"通话时长", 0},
+		{"已取消", 0},
+		{"", 0},
+		{"Duration 5:7", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := parseCallDuration(tt.text); got != tt.want {
+				t.Errorf("parseCallDuration(%q) = %s, want %s", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCallWording(t *testing.T) {
+	tests := []struct {
+		text string
+		want CallOutcome
+	}{
+		{"通话时长 00:42", CallAnswered},
+		{"Duration: 1:02", CallAnswered},
+		{"Call duration 00:10", CallAnswered},
+		{"已拒绝", CallRejected},
+		{"Declined", CallRejected},
+		{"Rejected", CallRejected},
+		// "对方已取消" contain "已取消", caller side cancel be missed call of receiver
+		{"对方已取消", CallMissed},
+		{"未接听", CallMissed},
+		{"Missed", CallMissed},
+		{"Caller canceled", CallMissed},
+		{"已取消", CallCanceled},
+		{"Canceled", CallCanceled},
+		{"Cancelled", CallCanceled},
+		{"对方无应答", CallTimeout},
+		{"No answer", CallTimeout},
+		{"Unanswered", CallTimeout},
+		{"线路繁忙", CallUnknown},
+		{"", CallUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := parseCallWording(tt.text); got != tt.want {
+				t.Errorf("parseCallWording(%q) = %s, want %s", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLegacyCallOutcome(t *testing.T) {
+	tests := []struct {
+		wordingType int
+		direction   Direction
+		want        CallOutcome
+	}{
+		{4, Outgoing, CallAnswered},
+		{2, Outgoing, CallCanceled},
+		{3, Outgoing, CallAborted},
+		{3, Incoming, CallAborted},
+		{1, Outgoing, CallTimeout},
+		{1, Incoming, CallMissed},
+		{0, Incoming, CallUnknown},
+	}
+	for _, tt := range tests {
+		m := &Message{Type: 50, Direction: tt.direction, OldVoIP: &XmlOldVoIP{
+			VoIPLocalInfo: XmlVoIPLocalInfo{WordingType: tt.wordingType, Duration: 30},
+		}}
+		if got := m.Call().Outcome; got != tt.want {
+			t.Errorf("wordingtype %d %s = %s, want %s", tt.wordingType, tt.direction, got, tt.want)
+		}
+	}
+}
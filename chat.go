@@ -3,20 +3,16 @@ package main
 import (
 	"bytes"
 	"crypto/aes"
-	"encoding/xml"
 	"errors"
 	"fmt"
-	"github.com/anonymous5l/wcdb/protobuf"
-	"github.com/h2non/filetype"
 	"github.com/urfave/cli/v2"
-	"google.golang.org/protobuf/proto"
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
-	"time"
 )
 
 var ChatCommand = &cli.Command{
@@ -37,10 +33,13 @@ var ChatCommand = &cli.Command{
 			Aliases:  []string{"r"},
 		},
 		&cli.StringFlag{
-			Name:     "talker",
-			Usage:    "dump chat list talker",
-			Required: true,
-			Aliases:  []string{"t"},
+			Name:    "talker",
+			Usage:   "dump chat list talker, username, nickname, alias or part of them",
+			Aliases: []string{"t"},
+		},
+		&cli.BoolFlag{
+			Name:  "all",
+			Usage: "dump every session chat list",
 		},
 		&cli.StringFlag{
 			Name:     "pass",
@@ -54,6 +53,38 @@ var ChatCommand = &cli.Command{
 			Value:   false,
 			Aliases: []string{"m"},
 		},
+		&cli.StringFlag{
+			Name:  "mention",
+			Usage: "only message @ given user",
+		},
+		&cli.BoolFlag{
+			Name:  "strict",
+			Usage: "abort on undecodable message instead of keep raw content",
+		},
+		&cli.StringFlag{
+			Name:  "since",
+			Usage: "only message sent since date, eg 2023-01-02 or 2023-01-02 15:04",
+		},
+		&cli.StringFlag{
+			Name:  "until",
+			Usage: "only message sent before date, date only include the whole day",
+		},
+		&cli.StringFlag{
+			Name:  "type",
+			Usage: "only message of type, eg text,image,link or 49/57",
+		},
+		&cli.StringFlag{
+			Name:  "status",
+			Usage: "only message in status or flag, eg failed,revoked,forwarded",
+		},
+		&cli.StringFlag{
+			Name:  "from",
+			Usage: "only message sent by username or display name",
+		},
+		&cli.StringFlag{
+			Name:  "grep",
+			Usage: "only message summary match regular expression",
+		},
 	},
 }
 
@@ -109,73 +140,113 @@ func getFd(path string) *os.File {
 	return o
 }
 
-func init() {
-	filetype.AddMatcher(filetype.AddType("aud", ""), func(i []byte) bool {
-		if bytes.Compare(i[:10], []byte{0x02, 0x23, 0x21, 0x53, 0x49, 0x4C, 0x4B, 0x5F, 0x56, 0x33}) == 0 {
-			return true
-		}
-		return false
-	})
-	filetype.AddMatcher(filetype.AddType("doc", ""), func(i []byte) bool {
-		if bytes.Compare(i[:8], []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}) == 0 {
-			if len(i) > 512 {
-				if bytes.Compare(i[512:516], []byte{0xec, 0xa5, 0xc1, 0x00}) == 0 {
-					return true
-				}
-			}
-		}
-		return false
-	})
-	filetype.AddMatcher(filetype.AddType("xls", ""), func(i []byte) bool {
-		if bytes.Compare(i[:8], []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}) == 0 {
-			if len(i) > 512 {
-				if bytes.Compare(i[512:516], []byte{0xfd, 0xff, 0xff, 0xff}) == 0 && i[516] == 0 {
-					return true
-				} else if bytes.Compare(i[512:516], []byte{0xfd, 0xff, 0xff, 0xff}) == 0 && i[516] == 2 {
-					return true
-				} else if bytes.Compare(i[512:520], []byte{0x09, 0x08, 0x10, 0x00, 0x00, 0x06, 0x05, 0x00}) == 0 {
-					return true
-				}
-			}
+func getExt(data []byte) string {
+	t := Sniff(data)
+	if t.Extension == "" {
+		return ""
+	}
+
+	return "." + t.Extension
+}
+
+type fileHint struct {
+	Name string
+	Ext  string
+	Size int
+}
+
+func newFileHint(msg *XmlAppMessage) *fileHint {
+	hint := &fileHint{Name: msg.Title}
+	if msg.AppAttach != nil {
+		hint.Ext = msg.AppAttach.FileExt
+		hint.Size = msg.AppAttach.TotalLen
+	}
+	return hint
+}
+
+// maxFileName most file systems limit a single name to 255 bytes, keep room for id suffix and extension
+const maxFileName = 200
+
+// reservedNames device names windows refuse as file name, with or without extension
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+func sanitizeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20, r == 0x7f:
+			return -1
+		case strings.ContainsRune(`<>:"/\|?*`, r):
+			return '_'
 		}
-		return false
-	})
-	filetype.AddMatcher(filetype.AddType("ppt", ""), func(i []byte) bool {
-		if bytes.Compare(i[:8], []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}) == 0 {
-			if len(i) > 512 {
-				if bytes.Compare(i[512:516], []byte{0xa0, 0x46, 0x1d, 0xf0}) == 0 {
-					return true
-				} else if bytes.Compare(i[512:516], []byte{0x00, 0x6e, 0x1e, 0xf0}) == 0 {
-					return true
-				} else if bytes.Compare(i[512:516], []byte{0x0F, 0x00, 0xE8, 0x03}) == 0 {
-					return true
-				} else if bytes.Compare(i[512:516], []byte{0xfd, 0xff, 0xff, 0xff}) == 0 && i[517] == 0 && i[518] == 0 {
-					return true
-				}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+	if len(name) > maxFileName {
+		// cut at the last rune boundary within limit
+		cut := 0
+		for i := range name {
+			if i > maxFileName {
+				break
 			}
+			cut = i
 		}
-		return false
-	})
+		name = strings.TrimRight(name[:cut], " .")
+	}
+	base := name
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	if reservedNames[strings.ToUpper(strings.TrimSpace(base))] {
+		name = "_" + name
+	}
+	return name
 }
 
-func getExt(data []byte) string {
-	t, err := filetype.Match(data)
-	if err != nil {
-		return ""
+// fileName build the output file name by hint, fallback media id and sniffed extension
+func (h *fileHint) fileName(id string, data []byte) string {
+	if h == nil {
+		return id + getExt(data)
 	}
 
-	return "." + t.Extension
+	// thumbnail or truncated media not the declared attachment
+	if h.Size > 0 && h.Size != len(data) {
+		return id + getExt(data)
+	}
+
+	ext := strings.ToLower(strings.TrimLeft(sanitizeFileName(h.Ext), "."))
+	name := sanitizeFileName(h.Name)
+	if ext != "" && strings.EqualFold(filepath.Ext(name), "."+ext) {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	if name == "" {
+		name = id
+	}
+
+	if ext == "" {
+		if e := filepath.Ext(name); e != "" {
+			return name
+		}
+		return name + getExt(data)
+	}
+
+	return name + "." + ext
 }
 
-func dumpFile(db *BackupDB, resource, pass, dir, id string) error {
+func readMedia(db *BackupDB, resource, pass, id string) ([]byte, error) {
 	media, err := db.MsgMedia(id)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	file, err := db.FileSegment(media.MediaId)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	buf := bytes.NewBuffer([]byte{})
@@ -183,76 +254,48 @@ func dumpFile(db *BackupDB, resource, pass, dir, id string) error {
 		f := file[i]
 		fd := getFd(filepath.Join(resource, f.FileName))
 		if _, err = fd.Seek(f.OffSet, io.SeekStart); err != nil {
-			return err
+			return nil, err
 		}
 		chunk := make([]byte, f.Length, f.Length)
 		n, err := fd.Read(chunk)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if chunk, err = aesDecrypt([]byte(pass), chunk[:n], i == len(file)-1); err != nil {
-			return err
+			return nil, err
 		}
 		buf.Write(chunk)
 	}
 
-	totalBuf := buf.Bytes()
-
-	ext := getExt(totalBuf)
+	return buf.Bytes(), nil
+}
 
-	o, err := os.Create(filepath.Join(dir, id) + ext)
+func dumpFile(db *BackupDB, resource, pass, dir, id string, hint *fileHint) (string, error) {
+	totalBuf, err := readMedia(db, resource, pass, id)
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer o.Close()
 
-	if _, err = o.Write(totalBuf); err != nil {
-		return err
+	filename := filepath.Join(dir, hint.fileName(id, totalBuf))
+	if hint != nil {
+		// same original name from different message, dump again keep the file of same content
+		if existing, err := os.ReadFile(filename); err == nil && !bytes.Equal(existing, totalBuf) {
+			ext := filepath.Ext(filename)
+			filename = strings.TrimSuffix(filename, ext) + " (" + id + ")" + ext
+		}
 	}
 
-	return nil
-}
-
-func printGroupMessage(strs *bytes.Buffer, msg XmlMessage) (err error) {
-	if msg.AppMsg.RecordItem == nil {
-		strs.WriteString("[CombineMessage]")
-		return nil
+	o, err := os.Create(filename)
+	if err != nil {
+		return "", err
 	}
+	defer o.Close()
 
-	var dataList *XmlRecordMessageDataList
-
-	if strings.HasPrefix(msg.AppMsg.RecordItem.Value, "<recorditem>") {
-		var combine XmlMessageRecordItem
-		if err = xml.Unmarshal([]byte(msg.AppMsg.RecordItem.Value), &combine); err != nil {
-			return
-		}
-		dataList = combine.RecordInfo.DataList
-	} else if strings.HasPrefix(msg.AppMsg.RecordItem.Value, "<recordinfo>") {
-		var combine XmlRecordMessage
-		if err = xml.Unmarshal([]byte(msg.AppMsg.RecordItem.Value), &combine); err != nil {
-			return
-		}
-		dataList = combine.DataList
-	} else {
-		fmt.Println(msg.AppMsg.RecordItem.Value)
-	}
-
-	strs.WriteString("[CombineMessage\n")
-	items := dataList.DataItems
-	for i := 0; i < len(items); i++ {
-		item := items[i]
-		strs.WriteString(item.SourceName)
-		strs.WriteString(" : ")
-		if item.DataDesc != "" {
-			strs.WriteString(item.DataDesc)
-		} else {
-			strs.WriteString(item.DataTitle)
-		}
-		strs.WriteString("\n")
+	if _, err = o.Write(totalBuf); err != nil {
+		return "", err
 	}
-	strs.WriteString("]")
 
-	return nil
+	return filename, nil
 }
 
 func actionChat(ctx *cli.Context) error {
@@ -261,9 +304,39 @@ func actionChat(ctx *cli.Context) error {
 	talker := ctx.String("talker")
 	pass := Pass(ctx.String("pass"))
 	media := ctx.Bool("media")
+	strict := ctx.Bool("strict")
 	if !pass.Valid() {
 		return ErrInvalidPassKey
 	}
+	if ctx.Bool("all") {
+		talker = ""
+	} else if talker == "" {
+		return errors.New("talker or --all required")
+	}
+
+	opts := LoadOptions{Strict: strict}
+	filter := MessageFilter{
+		Types:   parseTypes(ctx.String("type")),
+		States:  parseTypes(ctx.String("status")),
+		From:    ctx.String("from"),
+		Mention: ctx.String("mention"),
+	}
+	var err error
+	if since := ctx.String("since"); since != "" {
+		if opts.Since, err = parseDate(since); err != nil {
+			return err
+		}
+	}
+	if until := ctx.String("until"); until != "" {
+		if opts.Until, err = parseUntil(until); err != nil {
+			return err
+		}
+	}
+	if grep := ctx.String("grep"); grep != "" {
+		if filter.Grep, err = regexp.Compile(grep); err != nil {
+			return err
+		}
+	}
 
 	defer releaseFds()
 
@@ -273,296 +346,237 @@ func actionChat(ctx *cli.Context) error {
 	}
 	defer db.Close()
 
-	ids, err := db.Name2ID()
+	talkers, err := selectTalkers(db, talker)
 	if err != nil {
 		return err
 	}
 
-	getTalkerId := func(name string) int {
-		for i := 0; i < len(ids); i++ {
-			if ids[i].UsrName == name {
-				return i + 1
-			}
-		}
-		return -1
+	book, err := NewContactBook(db)
+	if err != nil {
+		return err
+	}
+
+	if opts.Owner, err = detectOwner(db, resource, pass); err != nil {
+		return err
 	}
 
-	talkerId := getTalkerId(talker)
+	emojiDir := filepath.Join("res", "emoji")
+	emojis := NewEmojiIndex(emojiDir)
 
-	if talkerId < 0 {
-		return errors.New("no record")
+	for i := 0; i < len(talkers); i++ {
+		if len(talkers) > 1 {
+			fmt.Printf("==> %s (%s) <==\n", book.Name(talkers[i]), talkers[i])
+		}
+		if err = printChat(db, resource, pass, talkers[i], book, emojis, opts, &filter, media); err != nil {
+			return err
+		}
 	}
 
-	strs := bytes.NewBufferString("")
+	// stickers dumped by chat be cataloged same as emoji command
+	if media && len(emojis.Entries()) > 0 {
+		if err = mkdirIfNotExist(emojiDir); err != nil {
+			return err
+		}
+		return emojis.WriteJSON(filepath.Join(emojiDir, "index.json"))
+	}
+
+	return nil
+}
 
-	msgs, err := db.MsgSegment(talkerId)
+func printChat(db *BackupDB, resource string, pass Pass, talker string, book *ContactBook, emojis *EmojiIndex, opts LoadOptions, filter *MessageFilter, media bool) error {
+	messages, err := loadMessages(db, resource, pass, talker, book, opts)
 	if err != nil {
 		return err
 	}
 
-	for i := 0; i < len(msgs); i++ {
-		msg := msgs[i]
+	resourcePath := filepath.Join("res", talker)
+	if media {
+		if err = mkdirIfNotExist(resourcePath); err != nil {
+			return err
+		}
+	}
 
-		bakFilename := filepath.Join(resource, msg.FilePath)
+	strs := bytes.NewBufferString("")
 
-		bakFile := getFd(bakFilename)
+	for i := 0; i < len(messages); i++ {
+		message := messages[i]
 
-		if _, err = bakFile.Seek(msg.OffSet, io.SeekStart); err != nil {
-			return err
+		if !filter.Match(message) {
+			continue
+		}
+
+		if media {
+			if err = dumpMessageMedia(db, resource, string(pass), resourcePath, emojis, message); err != nil {
+				return err
+			}
 		}
 
-		var dataSize int
+		strs.Reset()
 
-		data := make([]byte, msg.Length, msg.Length)
+		strs.WriteString(fmt.Sprintf("%20d", message.Id))
+		strs.WriteString(" | ")
 
-		if dataSize, err = bakFile.Read(data); err != nil {
-			return err
+		color, arrow := "\x1B[1;32m(", ") <- : "
+		if message.Direction == Incoming {
+			color, arrow = "\x1B[1;37m(", ") -> : "
 		}
-		if dataSize != len(data) {
-			return errors.New("invalid BAK file")
+		// highlight @ me message
+		if opts.Owner != "" && message.Mentioned(opts.Owner) {
+			color = "\x1B[1;33m("
 		}
+		strs.WriteString(color)
+		strs.WriteString(message.Time.Format("2006-01-02 15:04:05"))
+		strs.WriteString(arrow)
 
-		if data, err = aesDecrypt([]byte(pass), data, true); err != nil {
-			return err
+		if isChatroom(talker) && message.Sender != talker {
+			strs.WriteString(message.SenderName)
+			strs.WriteString(": ")
 		}
 
-		resourcePath := filepath.Join("res", talker)
-		if media {
-			if _, err = os.Stat(resourcePath); err != nil {
-				if os.IsNotExist(err) {
-					if err = os.MkdirAll(resourcePath, 0755); err != nil {
-						return err
-					}
-				}
-			}
-		}
+		strs.WriteString(message.Summary())
 
-		var pMessages protobuf.BakChatMsgList
-		if err = proto.Unmarshal(data, &pMessages); err != nil {
-			return err
+		for j := 0; j < len(message.Files); j++ {
+			strs.WriteString(" <")
+			strs.WriteString(message.Files[j])
+			strs.WriteString(">")
 		}
 
-		strs.Reset()
-		for i := 0; i < int(pMessages.GetCount()); i++ {
-			message := pMessages.GetList()[i]
+		strs.WriteString("\u001B[0m")
 
-			if strs.Len() > 0 {
-				strs.WriteString("\n")
-			}
+		fmt.Println(strs.String())
+	}
 
-			if media {
-				medias := message.GetMediaId()
-				for j := 0; j < len(medias); j++ {
-					id := medias[j]
-					if err = dumpFile(db, resource, string(pass), resourcePath, id.GetStr()); err != nil {
-						return err
-					}
-				}
-			}
+	if stats := newDecodeStats(messages); !stats.Empty() {
+		fmt.Fprintln(os.Stderr, stats)
+	}
 
-			msgId := message.GetNewMsgId()
+	return nil
+}
 
-			strs.WriteString(fmt.Sprintf("%20d", msgId))
-			strs.WriteString(" | ")
+func dumpMessageMedia(db *BackupDB, resource, pass, dir string, emojis *EmojiIndex, message *Message) error {
+	err := dumpMessageAttachments(db, resource, pass, dir, emojis, message)
+	// inline buffer still written when full media missing, it is all left then
+	dumpInlineBuffer(dir, message)
+	return err
+}
 
-			millTime := time.UnixMilli(message.GetClientMsgMillTime())
+func dumpMessageAttachments(db *BackupDB, resource, pass, dir string, emojis *EmojiIndex, message *Message) error {
+	if message.Err != nil {
+		return dumpMessageFiles(db, resource, pass, dir, nil, message)
+	}
 
-			if message.FromUserName.GetStr() == talker {
-				strs.WriteString("\x1B[1;37m(")
-				strs.WriteString(millTime.Format("2006-01-02 15:04:05"))
-				strs.WriteString(") -> : ")
-			} else {
-				strs.WriteString("\x1B[1;32m(")
-				strs.WriteString(millTime.Format("2006-01-02 15:04:05"))
-				strs.WriteString(") <- : ")
-			}
+	if message.Type == 47 {
+		entry := emojis.Add(message.Xml.Emoji, message.Sender, message.Time)
+		if err := emojis.Dump(db, resource, pass, entry, message.MediaIds); err != nil {
+			return err
+		}
+		if entry != nil && entry.File != "" {
+			message.Files = append(message.Files, entry.File)
+		}
+		return nil
+	}
 
-			// 10000 be contacts notify message
-			// 1 text message
-			// 3 image
-			// 34 voice message
-			// 47 emoji
-			// 62 short video
-			// 50 voip message
-			// 48 location
-			// 76 qq music
-			// 3 netease music
-			// 4 red book
-			// 42 name card
-			// 19 group join refer message
-			// 49 composite message
-			//   type - 6 - file
-			//   type - 57 - refer message
-			//   type - 33 - applet
-			//   type - 36 - app share
-			//   type - 17 - realtime location share
-			//   type - 2000 - money transfer
-			//   type - 2001 - lucky money
-			// 62 tickle
-			msgType := message.GetType()
-
-			content := message.GetContent().GetStr()
-
-			switch msgType {
-			case 42:
-				var xmlMessage XmlNameCard
-				if err = xml.Unmarshal([]byte(content), &xmlMessage); err != nil {
-					return err
-				}
-				strs.WriteString("[NameCard: ")
-				strs.WriteString(xmlMessage.NickName)
-				strs.WriteString("]")
-			case 49:
-				var xmlMessage XmlMessage
-				if err = xml.Unmarshal([]byte(content), &xmlMessage); err != nil {
-					return err
-				}
-				if xmlMessage.AppMsg == nil {
-					break
-				}
-				switch xmlMessage.AppMsg.Type {
-				case 19:
-					if err = printGroupMessage(strs, xmlMessage); err != nil {
-						return err
-					}
-				case 62:
-					strs.WriteString("[Tickle]")
-				case 57:
-					strs.WriteString(xmlMessage.AppMsg.Title)
-					strs.WriteString(" [Refer: ")
-					strs.WriteString(xmlMessage.AppMsg.ReferMsg.DisplayName)
-					strs.WriteString(":")
-					strs.WriteString(xmlMessage.AppMsg.ReferMsg.Content)
-					strs.WriteString("]")
-				case 33:
-					strs.WriteString("[Applet: ")
-					strs.WriteString(xmlMessage.AppMsg.Title)
-					strs.WriteString("]")
-				case 36:
-					strs.WriteString("[App: ")
-					strs.WriteString(xmlMessage.AppMsg.Title)
-					strs.WriteString("]")
-				case 4, 5:
-					strs.WriteString("[Link: ")
-					strs.WriteString(xmlMessage.AppMsg.Title)
-					strs.WriteString("]")
-				case 76, 3:
-					strs.WriteString("[Music: ")
-					strs.WriteString(xmlMessage.AppMsg.Title)
-					strs.WriteString("]")
-				case 6:
-					strs.WriteString("[File: ")
-					strs.WriteString(xmlMessage.AppMsg.Title)
-					strs.WriteString("]")
-				case 2001, 2000:
-					strs.WriteString("[" + xmlMessage.AppMsg.Title + "]")
-				default:
-					strs.WriteString(content)
-				}
-			case 48:
-				var xmlMessage XmlMessage
-				if err = xml.Unmarshal([]byte(content), &xmlMessage); err != nil {
-					return err
-				}
-				strs.WriteString("[Location: ")
-				strs.WriteString(xmlMessage.Location.Label)
-				strs.WriteString("]")
-			case 47:
-				var xmlMessage XmlMessage
-				if err = xml.Unmarshal([]byte(content), &xmlMessage); err != nil {
-					return err
-				}
-				strs.WriteString("[Emoji: ")
-				strs.WriteString(xmlMessage.Emoji.MD5)
-				strs.WriteString("]")
-			case 34:
-				if strings.HasPrefix(content, "<msg>") {
-					var xmlMessage XmlMessage
-					if err = xml.Unmarshal([]byte(content), &xmlMessage); err != nil {
-						return err
-					}
-
-					strs.WriteString("[Voice: ")
-					strs.WriteString(strconv.FormatFloat(float64(xmlMessage.Voice.VoiceLength)/1000, 'f', 1, 64))
-					strs.WriteByte('s')
-					strs.WriteString("]")
-				} else {
-					strs.WriteString("[Voice]")
-				}
-			case 43:
-				var xmlMessage XmlMessage
-				if err = xml.Unmarshal([]byte(content), &xmlMessage); err != nil {
-					return err
-				}
-
-				strs.WriteString("[Video: ")
-				strs.WriteString(strconv.FormatInt(int64(xmlMessage.Video.PlayLength), 10))
-				strs.WriteByte('s')
-				strs.WriteString("]")
-			case 50:
-				if strings.HasPrefix(content, "<voipinvitemsg>") {
-					var voip XmlOldVoIP
-					if err = xml.Unmarshal([]byte("<xml>"+content+"</xml>"), &voip); err != nil {
-						return err
-					}
-
-					if voip.VoIPInviteMsg.InviteType == 0 {
-						strs.WriteString("[VideoCall: ")
-					} else if voip.VoIPInviteMsg.InviteType == 1 {
-						strs.WriteString("[VoiceCall: ")
-					}
-
-					switch voip.VoIPLocalInfo.WordingType {
-					case 4:
-						strs.WriteString(strconv.FormatInt(int64(voip.VoIPLocalInfo.Duration), 10))
-						strs.WriteString("s")
-					case 2:
-						strs.WriteString("Canceled")
-					case 3:
-						strs.WriteString("Aborted")
-					case 1: // FIXME maybe don't known
-						strs.WriteString("Timeout")
-					}
-
-					strs.WriteString("]")
-				} else {
-
-					var voip XmlVoIP
-					if err = xml.Unmarshal([]byte(content), &voip); err != nil {
-						return err
-					}
-
-					if voip.VoIPBubbleMsg.RoomType == 0 {
-						strs.WriteString("[VideoCall: ")
-					} else if voip.VoIPBubbleMsg.RoomType == 1 {
-						strs.WriteString("[VoiceCall: ")
-					}
-
-					strs.WriteString(voip.VoIPBubbleMsg.Msg)
-					strs.WriteString("]")
-				}
-			case 3:
-				var xmlMessage XmlMessage
-				if err = xml.Unmarshal([]byte(content), &xmlMessage); err != nil {
-					return err
-				}
-
-				strs.WriteString("[Image: ")
-				strs.WriteString(xmlMessage.Image.MD5)
-				strs.WriteString("]")
-			case 1, 10000:
-				strs.WriteString(content)
-			default:
-				strs.WriteString(strconv.FormatUint(uint64(msgType), 10))
-				strs.WriteString(":")
-				strs.WriteString(content)
-			}
+	var hint *fileHint
+	if message.Type == 49 && message.Xml.AppMsg.Type == 6 {
+		hint = newFileHint(message.Xml.AppMsg)
+	}
 
-			strs.WriteString("\u001B[0m")
+	if message.Record != nil {
+		if err := message.Record.Walk(func(item *RecordItem) error {
+			return dumpRecordItem(db, resource, pass, dir, item)
+		}); err != nil {
+			return err
 		}
+	}
 
-		fmt.Println(strs.String())
+	return dumpMessageFiles(db, resource, pass, dir, hint, message)
+}
+
+func dumpMessageFiles(db *BackupDB, resource, pass, dir string, hint *fileHint, message *Message) error {
+	for i := 0; i < len(message.MediaIds); i++ {
+		filename, err := dumpFile(db, resource, pass, dir, message.MediaIds[i], hint)
+		if err != nil {
+			return err
+		}
+		message.Files = append(message.Files, filename)
 	}
 
 	return nil
 }
+
+// inlineBufferLabel voice or thumb by what buffer sniff as then message type,
+// bufferType number when neither tell
+func inlineBufferLabel(message *Message, t FileType) string {
+	switch {
+	case t == FileTypeSilk || strings.HasPrefix(t.MIME, "audio/"):
+		return "voice"
+	case t == FileTypeDat || t == FileTypeWxgf || t == FileTypeHeic || strings.HasPrefix(t.MIME, "image/"):
+		return "thumb"
+	}
+	switch message.Type {
+	case 34:
+		return "voice"
+	case 3, 43, 47, 49:
+		return "thumb"
+	}
+	if message.BufferType != 0 {
+		return "buffer" + strconv.FormatUint(uint64(message.BufferType), 10)
+	}
+	return "inline"
+}
+
+// sameAsFile buffer identical to content of already written file
+func sameAsFile(buf []byte, filename string) bool {
+	info, err := os.Stat(filename)
+	if err != nil || info.Size() != int64(len(buf)) {
+		return false
+	}
+	data, err := os.ReadFile(filename)
+	return err == nil && bytes.Equal(data, buf)
+}
+
+// dumpInlineBuffer write message embedded buffer unless same as media already written,
+// write failure only reported since message itself still readable
+func dumpInlineBuffer(dir string, message *Message) {
+	if len(message.Buffer) == 0 {
+		return
+	}
+	for i := 0; i < len(message.Files); i++ {
+		if sameAsFile(message.Buffer, message.Files[i]) {
+			return
+		}
+	}
+
+	t := Sniff(message.Buffer)
+	ext := ".bin"
+	if t.Extension != "" {
+		ext = "." + t.Extension
+	}
+	filename := filepath.Join(dir, strconv.FormatUint(message.Id, 10)+"_"+inlineBufferLabel(message, t)+ext)
+	if err := os.WriteFile(filename, message.Buffer, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "message %d inline buffer: %s\n", message.Id, err)
+		return
+	}
+	message.Files = append(message.Files, filename)
+}
+
+func dumpRecordItem(db *BackupDB, resource, pass, dir string, item *RecordItem) error {
+	switch item.DataType {
+	case RecordImage, RecordVoice, RecordVideo, RecordFile:
+	default:
+		return nil
+	}
+
+	media, err := db.FindMedia(item.DataId, item.FullMD5)
+	if err != nil || media == nil {
+		return err
+	}
+
+	var hint *fileHint
+	if item.DataType == RecordFile {
+		hint = &fileHint{Name: item.Title, Ext: item.Format, Size: item.Size}
+	}
+
+	item.File, err = dumpFile(db, resource, pass, dir, media.MediaIdStr, hint)
+	return err
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "report.pdf", "report.pdf"},
+		{"invalid characters", `a<b>c:d"e/f\g|h?i*j.txt`, "a_b_c_d_e_f_g_h_i_j.txt"},
+		{"control characters", "a\x00b\x1fc\x7f.txt", "abc.txt"},
+		{"trim dot and space", " .name. ", "name"},
+		{"reserved", "CON", "_CON"},
+		{"reserved lower case with extension", "nul.txt", "_nul.txt"},
+		{"reserved com port", "com1.log", "_com1.log"},
+		{"not reserved", "console.txt", "console.txt"},
+		{"not reserved digit", "COM10", "COM10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeFileName(tt.in); got != tt.want {
+				t.Errorf("sanitizeFileName(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeFileNameTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want int
+	}{
+		{"ascii", strings.Repeat("a", 300), maxFileName},
+		// 3 byte rune never split, 66 runes fit in 198 bytes
+		{"multi byte", strings.Repeat("文", 100), 198},
+		{"trailing dot after cut", strings.Repeat("a", maxFileName-1) + ". b", maxFileName - 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sanitizeFileName(tt.in)
+			if len(got) != tt.want {
+				t.Errorf("len = %d, want %d", len(got), tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("invalid utf8 %q", got)
+			}
+		})
+	}
+}
+
+func TestDumpInlineBuffer(t *testing.T) {
+	silk := append([]byte{}, silkHead...)
+	png := []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A, 0, 0, 0, 0x0D, 0x49, 0x48, 0x44, 0x52}
+	tests := []struct {
+		name     string
+		message  *Message
+		existing []byte
+		want     string
+	}{
+		{"voice", &Message{Id: 1, Type: 34, Buffer: silk}, nil, "1_voice.aud"},
+		{"thumb", &Message{Id: 2, Type: 3, Buffer: png}, nil, "2_thumb.png"},
+		{"unknown by buffer type", &Message{Id: 3, Type: 1, BufferType: 7, Buffer: []byte("data")}, nil, "3_buffer7.bin"},
+		{"unknown", &Message{Id: 4, Type: 1, Buffer: []byte("data")}, nil, "4_inline.bin"},
+		{"same as media", &Message{Id: 5, Type: 3, Buffer: png}, png, ""},
+		{"differ from media", &Message{Id: 6, Type: 3, Buffer: png}, png[:8], "6_thumb.png"},
+		{"empty", &Message{Id: 7, Type: 3}, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.existing != nil {
+				media := filepath.Join(dir, "media.png")
+				if err := os.WriteFile(media, tt.existing, 0644); err != nil {
+					t.Fatal(err)
+				}
+				tt.message.Files = []string{media}
+			}
+			before := len(tt.message.Files)
+			dumpInlineBuffer(dir, tt.message)
+			added := tt.message.Files[before:]
+			if tt.want == "" {
+				if len(added) != 0 {
+					t.Errorf("wrote %q, want nothing", added)
+				}
+				return
+			}
+			if len(added) != 1 || filepath.Base(added[0]) != tt.want {
+				t.Fatalf("wrote %q, want %s", added, tt.want)
+			}
+			if data, err := os.ReadFile(added[0]); err != nil || !bytes.Equal(data, tt.message.Buffer) {
+				t.Errorf("content %q, %v", data, err)
+			}
+		})
+	}
+}
+
+func TestDumpInlineBufferWriteError(t *testing.T) {
+	m := &Message{Id: 1, Type: 34, Buffer: []byte("data")}
+	dumpInlineBuffer(filepath.Join(t.TempDir(), "missing"), m)
+	if len(m.Files) != 0 {
+		t.Errorf("Files = %q after failed write", m.Files)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"google.golang.org/protobuf/encoding/protowire"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ConfigEntry decoded Config table row
+type ConfigEntry struct {
+	Key string
+	// Kind text, int, time, proto or blob
+	Kind   string
+	Value  string
+	Time   time.Time     `json:"-"`
+	Fields []ConfigField `json:",omitempty"`
+	Raw    []byte        `json:"-"`
+}
+
+// ConfigField top level field of protobuf payload
+type ConfigField struct {
+	Number int
+	Value  string
+}
+
+func configKeyIs(key string, words ...string) bool {
+	key = strings.ToLower(key)
+	for i := 0; i < len(words); i++ {
+		if strings.Contains(key, words[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func isPrintable(b []byte) bool {
+	if len(b) == 0 || !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeProto parse top level fields, nil when buf is not a whole protobuf message
+func decodeProto(buf []byte) []ConfigField {
+	var fields []ConfigField
+	for len(buf) > 0 {
+		num, typ, n := protowire.ConsumeTag(buf)
+		if n < 0 || num > 1<<16 {
+			return nil
+		}
+		buf = buf[n:]
+		field := ConfigField{Number: int(num)}
+		switch typ {
+		case protowire.VarintType:
+			v, m := protowire.ConsumeVarint(buf)
+			if m < 0 {
+				return nil
+			}
+			field.Value, n = strconv.FormatUint(v, 10), m
+		case protowire.Fixed32Type:
+			v, m := protowire.ConsumeFixed32(buf)
+			if m < 0 {
+				return nil
+			}
+			field.Value, n = strconv.FormatUint(uint64(v), 10), m
+		case protowire.Fixed64Type:
+			v, m := protowire.ConsumeFixed64(buf)
+			if m < 0 {
+				return nil
+			}
+			field.Value, n = strconv.FormatUint(v, 10), m
+		case protowire.BytesType:
+			v, m := protowire.ConsumeBytes(buf)
+			if m < 0 {
+				return nil
+			}
+			if isPrintable(v) {
+				field.Value = string(v)
+			} else {
+				field.Value = hex.EncodeToString(v)
+			}
+			n = m
+		default:
+			return nil
+		}
+		buf = buf[n:]
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func decodeConfigTime(buf []byte) (time.Time, bool) {
+	var ts int64
+	switch {
+	case isPrintable(buf):
+		v, err := strconv.ParseInt(strings.TrimSpace(string(buf)), 10, 64)
+		if err != nil {
+			return time.Time{}, false
+		}
+		ts = v
+	case len(buf) == 4:
+		ts = int64(binary.LittleEndian.Uint32(buf))
+	case len(buf) == 8:
+		ts = int64(binary.LittleEndian.Uint64(buf))
+	}
+	if ts <= 0 {
+		return time.Time{}, false
+	}
+	return unixTime(ts), true
+}
+
+// decodeConfig recognize text, timestamp, integer and protobuf payload, hex otherwise
+func decodeConfig(c Config) *ConfigEntry {
+	e := &ConfigEntry{Key: c.Key, Raw: c.Buf}
+	if configKeyIs(c.Key, "time", "date") {
+		if t, ok := decodeConfigTime(c.Buf); ok {
+			e.Kind, e.Time, e.Value = "time", t, t.Format(time.RFC3339)
+			return e
+		}
+	}
+	switch {
+	case len(c.Buf) == 0:
+		e.Kind = "text"
+	case isPrintable(c.Buf):
+		e.Kind, e.Value = "text", string(c.Buf)
+	case len(c.Buf) == 4:
+		e.Kind, e.Value = "int", strconv.FormatUint(uint64(binary.LittleEndian.Uint32(c.Buf)), 10)
+	case len(c.Buf) == 8:
+		e.Kind, e.Value = "int", strconv.FormatUint(binary.LittleEndian.Uint64(c.Buf), 10)
+	default:
+		if e.Fields = decodeProto(c.Buf); len(e.Fields) > 0 {
+			values := make([]string, 0, len(e.Fields))
+			for i := 0; i < len(e.Fields); i++ {
+				values = append(values, fmt.Sprintf("%d:%s", e.Fields[i].Number, e.Fields[i].Value))
+			}
+			e.Kind, e.Value = "proto", strings.Join(values, " ")
+		} else {
+			e.Kind, e.Value = "blob", hex.EncodeToString(c.Buf)
+		}
+	}
+	return e
+}
+
+// configValue first entry value which key contain any of words
+func configValue(entries []*ConfigEntry, words ...string) *ConfigEntry {
+	for i := 0; i < len(entries); i++ {
+		if configKeyIs(entries[i].Key, words...) && entries[i].Value != "" {
+			return entries[i]
+		}
+	}
+	return nil
+}
+
+// configOwner account username recorded by backup
+func configOwner(entries []*ConfigEntry) string {
+	if e := configValue(entries, "username", "usrname", "account", "wxid"); e != nil && e.Kind == "text" {
+		return e.Value
+	}
+	return ""
+}
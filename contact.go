@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"github.com/anonymous5l/wcdb/protobuf"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/urfave/cli/v2"
+	"sort"
+	"strings"
+)
+
+var ContactsCommand = &cli.Command{
+	Name:   "contacts",
+	Usage:  "list contact directory collect from backup",
+	Action: actionContacts,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "db",
+			Usage:   "decrypted Backup.db file path",
+			Value:   "Backup.db",
+			Aliases: []string{"d"},
+		},
+		&cli.StringFlag{
+			Name:    "resource",
+			Usage:   "BAK_0_XXX folder path, scan messages for name card and group member",
+			Aliases: []string{"r"},
+		},
+		&cli.StringFlag{
+			Name:    "pass",
+			Usage:   "decrypt media resource file chunk key",
+			Aliases: []string{"p"},
+		},
+	},
+}
+
+// name source priority, higher one override lower
+const (
+	nameFromRefer = iota + 1
+	nameFromSysMsg
+	nameFromNameCard
+	nameFromSession
+)
+
+type Contact struct {
+	UserName string
+	NickName string
+	Alias    string
+	// Groups known chatroom membership
+	Groups []string
+
+	priority int
+}
+
+type ContactBook struct {
+	contacts map[string]*Contact
+}
+
+// NewContactBook collect contacts from Session and Name2ID
+func NewContactBook(db *BackupDB) (*ContactBook, error) {
+	book := &ContactBook{contacts: make(map[string]*Contact)}
+
+	ids, err := db.Name2ID()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(ids); i++ {
+		book.contact(ids[i].UsrName)
+	}
+
+	sessions, err := db.Sessions()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(sessions); i++ {
+		book.setName(sessions[i].Talker, sessions[i].NickName, nameFromSession)
+	}
+
+	return book, nil
+}
+
+func (b *ContactBook) contact(username string) *Contact {
+	if username == "" {
+		return nil
+	}
+	c, ok := b.contacts[username]
+	if !ok {
+		c = &Contact{UserName: username}
+		b.contacts[username] = c
+	}
+	return c
+}
+
+func (b *ContactBook) setName(username, nickname string, priority int) {
+	c := b.contact(username)
+	if c == nil || nickname == "" || priority < c.priority {
+		return
+	}
+	c.NickName = nickname
+	c.priority = priority
+}
+
+func (b *ContactBook) addGroup(username, group string) {
+	c := b.contact(username)
+	if c == nil || username == group {
+		return
+	}
+	for i := 0; i < len(c.Groups); i++ {
+		if c.Groups[i] == group {
+			return
+		}
+	}
+	c.Groups = append(c.Groups, group)
+}
+
+// Observe learn names and group membership from decoded message
+func (b *ContactBook) Observe(m *Message) {
+	if isChatroom(m.Talker) {
+		b.addGroup(m.Sender, m.Talker)
+	}
+
+	if m.NameCard != nil {
+		b.setName(m.NameCard.UserName, m.NameCard.NickName, nameFromNameCard)
+		if c := b.contact(m.NameCard.UserName); c != nil && m.NameCard.Alias != "" {
+			c.Alias = m.NameCard.Alias
+		}
+	}
+
+	if m.Xml != nil && m.Xml.AppMsg != nil && m.Xml.AppMsg.ReferMsg != nil {
+		refer := m.Xml.AppMsg.ReferMsg
+		b.setName(refer.FromUsr, refer.DisplayName, nameFromRefer)
+		if isChatroom(m.Talker) {
+			b.addGroup(refer.FromUsr, m.Talker)
+		}
+	}
+
+	if m.SysMsg != nil && m.SysMsg.SysMsgTemplate != nil && m.SysMsg.SysMsgTemplate.ContentTemplate != nil {
+		links := m.SysMsg.SysMsgTemplate.ContentTemplate.LinkList
+		for i := 0; i < len(links); i++ {
+			members := links[i].MemberList
+			for j := 0; j < len(members); j++ {
+				b.setName(members[j].UserName, members[j].NickName, nameFromSysMsg)
+				if isChatroom(m.Talker) {
+					b.addGroup(members[j].UserName, m.Talker)
+				}
+			}
+		}
+	}
+}
+
+// Name display name fallback alias then username
+func (b *ContactBook) Name(username string) string {
+	if c, ok := b.contacts[username]; ok {
+		if c.NickName != "" {
+			return c.NickName
+		}
+		if c.Alias != "" {
+			return c.Alias
+		}
+	}
+	return username
+}
+
+func (b *ContactBook) Contact(username string) *Contact {
+	return b.contacts[username]
+}
+
+// Contacts sorted by username
+func (b *ContactBook) Contacts() []*Contact {
+	contacts := make([]*Contact, 0, len(b.contacts))
+	for _, c := range b.contacts {
+		contacts = append(contacts, c)
+	}
+	sort.Slice(contacts, func(i, j int) bool {
+		return contacts[i].UserName < contacts[j].UserName
+	})
+	return contacts
+}
+
+// loadContacts scan every session messages to complete contact book
+func loadContacts(db *BackupDB, resource string, pass Pass) (*ContactBook, error) {
+	book, err := NewContactBook(db)
+	if err != nil {
+		return nil, err
+	}
+
+	talkers, err := selectTalkers(db, "")
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(talkers); i++ {
+		talker := talkers[i]
+		talkerId, err := db.TalkerId(talker)
+		if err != nil {
+			return nil, err
+		}
+		if err = walkMessages(db, resource, pass, talkerId, func(item *protobuf.BakChatMsgItem) error {
+			switch item.GetType() {
+			case 42, 49, 10002:
+			default:
+				if !isChatroom(talker) {
+					return nil
+				}
+			}
+			book.Observe(newMessage(talker, item))
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return book, nil
+}
+
+func actionContacts(ctx *cli.Context) error {
+	dbName := ctx.String("db")
+	resource := ctx.String("resource")
+	pass := Pass(ctx.String("pass"))
+
+	defer releaseFds()
+
+	db, err := NewBackupDB(dbName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var book *ContactBook
+	if resource != "" {
+		if !pass.Valid() {
+			return ErrInvalidPassKey
+		}
+		book, err = loadContacts(db, resource, pass)
+	} else {
+		book, err = NewContactBook(db)
+	}
+	if err != nil {
+		return err
+	}
+
+	t := newTable()
+	t.AppendHeader(table.Row{"UserName", "NickName", "Alias", "Groups"})
+
+	contacts := book.Contacts()
+	for i := 0; i < len(contacts); i++ {
+		c := contacts[i]
+		groups := make([]string, 0, len(c.Groups))
+		for j := 0; j < len(c.Groups); j++ {
+			groups = append(groups, book.Name(c.Groups[j]))
+		}
+		t.AppendRow(table.Row{c.UserName, c.NickName, c.Alias, strings.Join(groups, ", ")})
+	}
+
+	t.AppendSeparator()
+	t.AppendFooter(table.Row{"", "Total", len(contacts), ""})
+
+	fmt.Println(t.Render())
+
+	return nil
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/anonymous5l/wcdb/protobuf"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/urfave/cli/v2"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+var EmojiCommand = &cli.Command{
+	Name:   "emoji",
+	Usage:  "catalog stickers into emoji index and gallery",
+	Action: actionEmoji,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "db",
+			Usage:   "decrypted Backup.db file path",
+			Value:   "Backup.db",
+			Aliases: []string{"d"},
+		},
+		&cli.StringFlag{
+			Name:     "resource",
+			Usage:    "BAK_0_XXX folder path",
+			Required: true,
+			Aliases:  []string{"r"},
+		},
+		&cli.StringFlag{
+			Name:    "talker",
+			Usage:   "only catalog talker stickers default all sessions",
+			Aliases: []string{"t"},
+		},
+		&cli.StringFlag{
+			Name:     "pass",
+			Usage:    "decrypt media resource file chunk key",
+			Required: true,
+			Aliases:  []string{"p"},
+		},
+		&cli.BoolFlag{
+			Name:    "media",
+			Usage:   "dump sticker file stored in backup",
+			Value:   false,
+			Aliases: []string{"m"},
+		},
+		&cli.StringFlag{
+			Name:    "output",
+			Usage:   "emoji index and gallery output directory",
+			Value:   filepath.Join("res", "emoji"),
+			Aliases: []string{"o"},
+		},
+		&cli.IntFlag{
+			Name:    "top",
+			Usage:   "print most used stickers count",
+			Value:   20,
+			Aliases: []string{"n"},
+		},
+	},
+}
+
+type EmojiEntry struct {
+	MD5        string         `json:"md5"`
+	ProductId  string         `json:"productId,omitempty"`
+	CDNURL     string         `json:"cdnUrl,omitempty"`
+	ThumbURL   string         `json:"thumbUrl,omitempty"`
+	EncryptURL string         `json:"encryptUrl,omitempty"`
+	AESKey     string         `json:"aesKey,omitempty"`
+	Width      int            `json:"width,omitempty"`
+	Height     int            `json:"height,omitempty"`
+	Count      int            `json:"count"`
+	FirstSeen  time.Time      `json:"firstSeen"`
+	LastSeen   time.Time      `json:"lastSeen"`
+	Senders    map[string]int `json:"senders"`
+	File       string         `json:"file,omitempty"`
+}
+
+type EmojiIndex struct {
+	dir     string
+	entries map[string]*EmojiEntry
+}
+
+func NewEmojiIndex(dir string) *EmojiIndex {
+	return &EmojiIndex{
+		dir:     dir,
+		entries: make(map[string]*EmojiEntry),
+	}
+}
+
+// validMD5 md5 come from sender xml, only 32 hex digits may become index key and file name
+func validMD5(md5 string) bool {
+	if len(md5) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(md5)
+	return err == nil
+}
+
+// Add count sticker of message, nil when md5 is not valid
+func (idx *EmojiIndex) Add(emoji *XmlEmoji, sender string, seen time.Time) *EmojiEntry {
+	if emoji == nil || !validMD5(emoji.MD5) {
+		return nil
+	}
+	entry, ok := idx.entries[emoji.MD5]
+	if !ok {
+		entry = &EmojiEntry{
+			MD5:       emoji.MD5,
+			FirstSeen: seen,
+			LastSeen:  seen,
+			Senders:   make(map[string]int),
+		}
+		idx.entries[emoji.MD5] = entry
+	}
+
+	// later message may carry url missing before
+	if entry.ProductId == "" {
+		entry.ProductId = emoji.ProductId
+	}
+	if entry.CDNURL == "" {
+		entry.CDNURL = emoji.CDNURL
+	}
+	if entry.ThumbURL == "" {
+		entry.ThumbURL = emoji.ThumbURL
+	}
+	if entry.EncryptURL == "" {
+		entry.EncryptURL = emoji.EncryptURL
+		entry.AESKey = emoji.AESKey
+	}
+	if entry.Width == 0 || entry.Height == 0 {
+		entry.Width = emoji.Width
+		entry.Height = emoji.Height
+	}
+
+	entry.Count++
+	entry.Senders[sender]++
+	if seen.Before(entry.FirstSeen) {
+		entry.FirstSeen = seen
+	}
+	if seen.After(entry.LastSeen) {
+		entry.LastSeen = seen
+	}
+
+	return entry
+}
+
+// Dump write sticker stored in backup once per md5
+func (idx *EmojiIndex) Dump(db *BackupDB, resource, pass string, entry *EmojiEntry, ids []string) error {
+	if entry == nil || entry.File != "" || len(ids) == 0 {
+		return nil
+	}
+
+	// dumped by previous run
+	if matches, _ := filepath.Glob(filepath.Join(idx.dir, entry.MD5+".*")); len(matches) > 0 {
+		entry.File = matches[0]
+		return nil
+	}
+
+	if err := mkdirIfNotExist(idx.dir); err != nil {
+		return err
+	}
+
+	for i := 0; i < len(ids); i++ {
+		data, err := readMedia(db, resource, pass, ids[i])
+		if err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			continue
+		}
+		filename := filepath.Join(idx.dir, entry.MD5+getExt(data))
+		if err = os.WriteFile(filename, data, 0644); err != nil {
+			return err
+		}
+		entry.File = filename
+		return nil
+	}
+
+	return nil
+}
+
+// Entries sorted by usage count
+func (idx *EmojiIndex) Entries() []*EmojiEntry {
+	entries := make([]*EmojiEntry, 0, len(idx.entries))
+	for _, entry := range idx.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].MD5 < entries[j].MD5
+	})
+	return entries
+}
+
+func (idx *EmojiIndex) WriteJSON(filename string) error {
+	o, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer o.Close()
+
+	encoder := json.NewEncoder(o)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(idx.Entries())
+}
+
+var emojiGalleryTemplate = template.Must(template.New("gallery").Funcs(template.FuncMap{
+	"base": filepath.Base,
+	"date": func(t time.Time) string {
+		return t.Format("2006-01-02 15:04:05")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Stickers</title>
+<style>
+body { font-family: sans-serif; }
+.grid { display: flex; flex-wrap: wrap; }
+.item { width: 160px; margin: 8px; text-align: center; font-size: 12px; word-break: break-all; }
+.item img { max-width: 120px; max-height: 120px; }
+</style>
+</head>
+<body>
+<h1>{{len .}} stickers</h1>
+<div class="grid">
+{{- range .}}
+<div class="item" id="{{.MD5}}">
+{{- if .File}}
+<img src="{{base .File}}" loading="lazy">
+{{- else if .ThumbURL}}
+<img src="{{.ThumbURL}}" loading="lazy">
+{{- else if .CDNURL}}
+<img src="{{.CDNURL}}" loading="lazy">
+{{- end}}
+<div>{{.MD5}}</div>
+<div>used {{.Count}} times by {{len .Senders}}</div>
+<div>{{date .FirstSeen}}<br>{{date .LastSeen}}</div>
+</div>
+{{- end}}
+</div>
+</body>
+</html>
+`))
+
+// WriteGallery render html page, local file must be in same directory
+func (idx *EmojiIndex) WriteGallery(filename string) error {
+	o, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer o.Close()
+
+	return emojiGalleryTemplate.Execute(o, idx.Entries())
+}
+
+func actionEmoji(ctx *cli.Context) error {
+	dbName := ctx.String("db")
+	resource := ctx.String("resource")
+	talker := ctx.String("talker")
+	pass := Pass(ctx.String("pass"))
+	media := ctx.Bool("media")
+	output := ctx.String("output")
+	top := ctx.Int("top")
+	if !pass.Valid() {
+		return ErrInvalidPassKey
+	}
+
+	defer releaseFds()
+
+	db, err := NewBackupDB(dbName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	talkers, err := selectTalkers(db, talker)
+	if err != nil {
+		return err
+	}
+
+	emojis := NewEmojiIndex(output)
+
+	for i := 0; i < len(talkers); i++ {
+		talkerId, err := db.TalkerId(talkers[i])
+		if err != nil {
+			return err
+		}
+
+		if err = walkMessages(db, resource, pass, talkerId, func(item *protobuf.BakChatMsgItem) error {
+			if item.GetType() != 47 {
+				return nil
+			}
+			message := newMessage(talkers[i], item)
+			if message.Err != nil {
+				return nil
+			}
+			entry := emojis.Add(message.Xml.Emoji, message.Sender, message.Time)
+			if media {
+				return emojis.Dump(db, resource, string(pass), entry, message.MediaIds)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	if err = mkdirIfNotExist(output); err != nil {
+		return err
+	}
+	if err = emojis.WriteJSON(filepath.Join(output, "index.json")); err != nil {
+		return err
+	}
+	if err = emojis.WriteGallery(filepath.Join(output, "index.html")); err != nil {
+		return err
+	}
+
+	t := newTable()
+	t.AppendHeader(table.Row{"MD5", "Count", "Senders", "FirstSeen", "LastSeen", "File"})
+
+	entries := emojis.Entries()
+	total := 0
+	for i := 0; i < len(entries); i++ {
+		e := entries[i]
+		total += e.Count
+		if top > 0 && i >= top {
+			continue
+		}
+		t.AppendRow(table.Row{
+			e.MD5,
+			e.Count,
+			len(e.Senders),
+			e.FirstSeen.Format("2006-01-02"),
+			e.LastSeen.Format("2006-01-02"),
+			e.File,
+		})
+	}
+
+	t.AppendSeparator()
+	t.AppendFooter(table.Row{fmt.Sprintf("%d stickers", len(entries)), total, "", "", "", ""})
+
+	fmt.Println(t.Render())
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEmojiIndexAddMD5(t *testing.T) {
+	tests := []struct {
+		name  string
+		md5   string
+		valid bool
+	}{
+		{"lower hex", "0123456789abcdef0123456789abcdef", true},
+		{"upper hex", "0123456789ABCDEF0123456789ABCDEF", true},
+		{"empty", "", false},
+		{"short", "0123456789abcdef", false},
+		{"not hex", "0123456789abcdef0123456789abcdeg", false},
+		{"path traversal", "../../../tmp/evil", false},
+		{"traversal padded to 32", "../../../../../../../../tmp/evil", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := NewEmojiIndex(t.TempDir())
+			entry := idx.Add(&XmlEmoji{MD5: tt.md5}, "wxid_a", time.Unix(1700000000, 0))
+			if (entry != nil) != tt.valid {
+				t.Fatalf("Add(%q) = %v, want valid %v", tt.md5, entry, tt.valid)
+			}
+			want := 0
+			if tt.valid {
+				want = 1
+			}
+			if got := len(idx.Entries()); got != want {
+				t.Errorf("%d entries indexed, want %d", got, want)
+			}
+			// rejected md5 never reach file system
+			if !tt.valid {
+				if err := idx.Dump(nil, "", "", entry, []string{"1"}); err != nil {
+					t.Errorf("Dump of rejected entry: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestEmojiIndexDumpExisting(t *testing.T) {
+	dir := t.TempDir()
+	md5 := "0123456789abcdef0123456789abcdef"
+	existing := filepath.Join(dir, md5+".gif")
+	if err := os.WriteFile(existing, []byte("GIF89a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	idx := NewEmojiIndex(dir)
+	entry := idx.Add(&XmlEmoji{MD5: md5}, "wxid_a", time.Unix(1700000000, 0))
+	if err := idx.Dump(nil, "", "", entry, []string{"1"}); err != nil {
+		t.Fatal(err)
+	}
+	if entry.File != existing {
+		t.Errorf("File = %q, want %q", entry.File, existing)
+	}
+}
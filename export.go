@@ -0,0 +1,428 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/urfave/cli/v2"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ExportCommand = &cli.Command{
+	Name:   "export",
+	Usage:  "export conversations with media into per talker folder",
+	Action: actionExport,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "db",
+			Usage:   "decrypted Backup.db file path",
+			Value:   "Backup.db",
+			Aliases: []string{"d"},
+		},
+		&cli.StringFlag{
+			Name:     "resource",
+			Usage:    "BAK_0_XXX folder path",
+			Required: true,
+			Aliases:  []string{"r"},
+		},
+		&cli.StringFlag{
+			Name:     "pass",
+			Usage:    "decrypt media resource file chunk key",
+			Required: true,
+			Aliases:  []string{"p"},
+		},
+		&cli.StringFlag{
+			Name:    "talker",
+			Usage:   "export only talker, username, nickname or part of them",
+			Aliases: []string{"t"},
+		},
+		&cli.BoolFlag{
+			Name:  "all",
+			Usage: "export every session",
+		},
+		&cli.StringFlag{
+			Name:    "out",
+			Usage:   "output directory",
+			Value:   "export",
+			Aliases: []string{"o"},
+		},
+		&cli.StringFlag{
+			Name:    "format",
+			Usage:   "conversation format html, txt or json",
+			Value:   "html",
+			Aliases: []string{"f"},
+		},
+		&cli.StringFlag{
+			Name:  "status",
+			Usage: "only export message in status or flag, eg failed,revoked,forwarded",
+		},
+		&cli.BoolFlag{
+			Name:  "with-status",
+			Usage: "include delivery status, flags, raw msgFlag, bufferType and sequentId of every message",
+		},
+		&cli.StringFlag{
+			Name:  "since",
+			Usage: "only message sent since date, eg 2023-01-02",
+		},
+		&cli.StringFlag{
+			Name:  "until",
+			Usage: "only message sent before date, date only include the whole day",
+		},
+	},
+}
+
+// ExportedMessage message view written by export, file path relative to conversation folder
+type ExportedMessage struct {
+	Id         uint64
+	Type       string
+	Kind       string
+	Time       time.Time
+	Sender     string
+	SenderName string
+	Direction  Direction
+	Summary    string
+	// Status Flags MsgFlag BufferType SequentId only filled with --with-status
+	Status     string `json:",omitempty"`
+	Flags      string `json:",omitempty"`
+	MsgFlag    uint32 `json:",omitempty"`
+	BufferType uint32 `json:",omitempty"`
+	SequentId  uint32 `json:",omitempty"`
+	ReplyTo    uint64 `json:",omitempty"`
+	Files      []string
+	Error      string `json:",omitempty"`
+}
+
+// Conversation manifest entry of exported talker
+type Conversation struct {
+	Talker   string
+	Name     string
+	Kind     string
+	Folder   string
+	File     string
+	Messages int
+	Media    int
+	First    time.Time
+	Last     time.Time
+}
+
+// exportPath file path relative to conversation folder with forward slash
+func exportPath(dir, file string) string {
+	if rel, err := filepath.Rel(dir, file); err == nil {
+		file = rel
+	}
+	return filepath.ToSlash(file)
+}
+
+func newExportedMessage(m *Message, dir string, status bool) *ExportedMessage {
+	// merged forward item file shown in summary and listed like top level media
+	var recordFiles []string
+	m.Record.Walk(func(item *RecordItem) error {
+		if item.File != "" {
+			item.File = exportPath(dir, item.File)
+			recordFiles = append(recordFiles, item.File)
+		}
+		return nil
+	})
+
+	e := &ExportedMessage{
+		Id:         m.Id,
+		Type:       m.TypeName(),
+		Kind:       m.Kind(),
+		Time:       m.Time,
+		Sender:     m.Sender,
+		SenderName: m.SenderName,
+		Direction:  m.Direction,
+		Summary:    m.Summary(),
+	}
+	if status {
+		e.Status, e.Flags = m.Status.String(), m.Flags.String()
+		e.MsgFlag, e.BufferType, e.SequentId = m.Flag, m.BufferType, m.SequentId
+	}
+	if m.ReplyTo != nil {
+		e.ReplyTo = m.ReplyTo.Id
+	}
+	if m.Err != nil {
+		e.Error = m.Err.Error()
+	}
+	for i := 0; i < len(m.Files); i++ {
+		e.Files = append(e.Files, exportPath(dir, m.Files[i]))
+	}
+	e.Files = append(e.Files, recordFiles...)
+	return e
+}
+
+// RawState msgFlag bufferType sequentId as stored, empty part left out
+func (e *ExportedMessage) RawState() string {
+	s := ""
+	if e.MsgFlag != 0 {
+		s += fmt.Sprintf(" flag=0x%x", e.MsgFlag)
+	}
+	if e.BufferType != 0 {
+		s += fmt.Sprintf(" buffer=%d", e.BufferType)
+	}
+	if e.SequentId != 0 {
+		s += fmt.Sprintf(" seq=%d", e.SequentId)
+	}
+	return s
+}
+
+func writeExportText(w io.Writer, messages []*ExportedMessage) error {
+	for i := 0; i < len(messages); i++ {
+		m := messages[i]
+		arrow := "->"
+		if m.Direction == Outgoing {
+			arrow = "<-"
+		}
+		line := fmt.Sprintf("%s %s %s: %s", m.Time.Format("2006-01-02 15:04:05"), arrow, m.SenderName, m.Summary)
+		if m.Status != "" {
+			line += " (" + m.Status
+			if m.Flags != "" {
+				line += "," + m.Flags
+			}
+			line += m.RawState() + ")"
+		}
+		for j := 0; j < len(m.Files); j++ {
+			line += " <" + m.Files[j] + ">"
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var exportFuncs = template.FuncMap{
+	"datetime": func(t time.Time) string {
+		return t.Format("2006-01-02 15:04:05")
+	},
+	"date": formatDate,
+	"image": func(name string) bool {
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".jpg", ".jpeg", ".png", ".gif", ".webp", ".bmp":
+			return true
+		}
+		return false
+	},
+}
+
+var exportChatTemplate = template.Must(template.New("chat").Funcs(exportFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Conversation.Name}}</title>
+<style>
+body { font-family: sans-serif; }
+.msg { margin: 6px 0; }
+.out { margin-left: 40px; background: #e7f7e7; }
+.time { color: #888; font-size: 12px; }
+.sender { font-weight: bold; }
+.status { color: #888; font-size: 12px; }
+.msg img { max-width: 240px; max-height: 240px; display: block; }
+</style>
+</head>
+<body>
+<p><a href="../index.html">index</a></p>
+<h1>{{.Conversation.Name}}</h1>
+{{- range .Messages}}
+<div class="msg {{.Direction}}" id="{{.Id}}">
+<span class="time">{{datetime .Time}}</span> <span class="sender">{{.SenderName}}</span>
+{{- if .Status}} <span class="status">{{.Status}}{{if .Flags}},{{.Flags}}{{end}}{{.RawState}}</span>{{end}}
+{{- if .ReplyTo}} <a href="#{{.ReplyTo}}">&#8617;</a>{{end}}
+<div>{{.Summary}}</div>
+{{- range .Files}}
+{{- if image .}}
+<a href="{{.}}"><img src="{{.}}" loading="lazy"></a>
+{{- else}}
+<a href="{{.}}">{{.}}</a>
+{{- end}}
+{{- end}}
+</div>
+{{- end}}
+</body>
+</html>
+`))
+
+var exportIndexTemplate = template.Must(template.New("index").Funcs(exportFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Conversations</title>
+<style>
+body { font-family: sans-serif; }
+td, th { padding: 4px 8px; text-align: left; }
+</style>
+</head>
+<body>
+<h1>{{len .}} conversations</h1>
+<table>
+<tr><th>Name</th><th>Talker</th><th>Kind</th><th>Messages</th><th>Media</th><th>First</th><th>Last</th></tr>
+{{- range .}}
+<tr><td><a href="{{.Folder}}/{{.File}}">{{.Name}}</a></td><td>{{.Talker}}</td><td>{{.Kind}}</td><td>{{.Messages}}</td><td>{{.Media}}</td><td>{{date .First}}</td><td>{{date .Last}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+func writeExportFile(filename string, write func(w io.Writer) error) error {
+	o, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err = write(o); err != nil {
+		o.Close()
+		return err
+	}
+	return o.Close()
+}
+
+// exportConversation write one talker messages and media into out/<talker>
+func exportConversation(db *BackupDB, resource string, pass Pass, out, format, talker string,
+	book *ContactBook, emojis *EmojiIndex, opts LoadOptions, filter *MessageFilter, status bool) (*Conversation, error) {
+	messages, err := loadMessages(db, resource, pass, talker, book, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	conversation := &Conversation{
+		Talker: talker,
+		Name:   book.Name(talker),
+		Kind:   chatKind(talker),
+		Folder: sanitizeFileName(talker),
+		File:   "messages." + format,
+	}
+	dir := filepath.Join(out, conversation.Folder)
+	if err = mkdirIfNotExist(dir); err != nil {
+		return nil, err
+	}
+
+	exported := make([]*ExportedMessage, 0, len(messages))
+	for i := 0; i < len(messages); i++ {
+		m := messages[i]
+		if !filter.Match(m) {
+			continue
+		}
+		// media missing from backup should not abort whole export
+		if err = dumpMessageMedia(db, resource, string(pass), dir, emojis, m); err != nil {
+			fmt.Fprintf(os.Stderr, "%s message %d media: %s\n", talker, m.Id, err)
+		}
+		if conversation.First.IsZero() || m.Time.Before(conversation.First) {
+			conversation.First = m.Time
+		}
+		if m.Time.After(conversation.Last) {
+			conversation.Last = m.Time
+		}
+		e := newExportedMessage(m, dir, status)
+		conversation.Media += len(e.Files)
+		exported = append(exported, e)
+	}
+	conversation.Messages = len(exported)
+
+	err = writeExportFile(filepath.Join(dir, conversation.File), func(w io.Writer) error {
+		switch format {
+		case "json":
+			return writeJSON(w, exported)
+		case "txt":
+			return writeExportText(w, exported)
+		}
+		return exportChatTemplate.Execute(w, struct {
+			Conversation *Conversation
+			Messages     []*ExportedMessage
+		}{conversation, exported})
+	})
+	return conversation, err
+}
+
+func actionExport(ctx *cli.Context) error {
+	dbName := ctx.String("db")
+	resource := ctx.String("resource")
+	pass := Pass(ctx.String("pass"))
+	talker := ctx.String("talker")
+	out := ctx.String("out")
+	format := ctx.String("format")
+	if !pass.Valid() {
+		return ErrInvalidPassKey
+	}
+	if ctx.Bool("all") {
+		talker = ""
+	} else if talker == "" {
+		return errors.New("talker or --all required")
+	}
+	switch format {
+	case "html", "txt", "json":
+	default:
+		return errors.New("unsupported format " + format)
+	}
+
+	status := ctx.Bool("with-status")
+	filter := MessageFilter{States: parseTypes(ctx.String("status"))}
+	var opts LoadOptions
+	var err error
+	if since := ctx.String("since"); since != "" {
+		if opts.Since, err = parseDate(since); err != nil {
+			return err
+		}
+	}
+	if until := ctx.String("until"); until != "" {
+		if opts.Until, err = parseUntil(until); err != nil {
+			return err
+		}
+	}
+
+	// one db handle and BAK fd cache shared by every conversation
+	defer releaseFds()
+
+	db, err := NewBackupDB(dbName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if opts.Owner, err = detectOwner(db, resource, pass); err != nil {
+		return err
+	}
+
+	talkers, err := selectTalkers(db, talker)
+	if err != nil {
+		return err
+	}
+
+	book, err := NewContactBook(db)
+	if err != nil {
+		return err
+	}
+
+	if err = mkdirIfNotExist(out); err != nil {
+		return err
+	}
+	emojis := NewEmojiIndex(filepath.Join(out, "emoji"))
+	if err = mkdirIfNotExist(filepath.Join(out, "emoji")); err != nil {
+		return err
+	}
+
+	conversations := make([]*Conversation, 0, len(talkers))
+	for i := 0; i < len(talkers); i++ {
+		fmt.Fprintf(os.Stderr, "[%d/%d] %s\n", i+1, len(talkers), talkers[i])
+		conversation, err := exportConversation(db, resource, pass, out, format, talkers[i], book, emojis, opts, &filter, status)
+		if err != nil {
+			return fmt.Errorf("export %s: %w", talkers[i], err)
+		}
+		conversations = append(conversations, conversation)
+	}
+
+	if err = emojis.WriteJSON(filepath.Join(out, "emoji", "index.json")); err != nil {
+		return err
+	}
+	if err = writeExportFile(filepath.Join(out, "manifest.json"), func(w io.Writer) error {
+		return writeJSON(w, conversations)
+	}); err != nil {
+		return err
+	}
+	return writeExportFile(filepath.Join(out, "index.html"), func(w io.Writer) error {
+		return exportIndexTemplate.Execute(w, conversations)
+	})
+}
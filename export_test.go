@@ -0,0 +1,49 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewExportedMessageRecordFiles(t *testing.T) {
+	dir := filepath.Join("out", "wxid_a")
+	content := `<msg><appmsg><title>chat history</title><type>19</type><recorditem><![CDATA[<recordinfo><datalist>` +
+		`<dataitem datatype="2"><sourcename>Carol</sourcename></dataitem>` +
+		`<dataitem datatype="1"><sourcename>Bob</sourcename><datadesc>text</datadesc></dataitem>` +
+		`</datalist></recordinfo>]]></recorditem></appmsg></msg>`
+	tests := []struct {
+		name   string
+		files  []string
+		record []string
+		want   []string
+	}{
+		{"no file", nil, nil, nil},
+		{"top level only", []string{filepath.Join(dir, "1.jpg")}, nil, []string{"1.jpg"}},
+		{"record item", nil, []string{filepath.Join(dir, "rec1.jpg"), ""}, []string{"rec1.jpg"}},
+		{"both", []string{filepath.Join(dir, "1_thumb.jpg")}, []string{filepath.Join(dir, "rec1.jpg"), ""}, []string{"1_thumb.jpg", "rec1.jpg"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMessage("wxid_a", newTestItem(49, content, ""))
+			if m.Err != nil || m.Record == nil || len(m.Record.Items) != 2 {
+				t.Fatalf("record not decoded: %v", m.Err)
+			}
+			m.Files = tt.files
+			for i := 0; i < len(tt.record); i++ {
+				m.Record.Items[i].File = tt.record[i]
+			}
+			e := newExportedMessage(m, dir, false)
+			if !reflect.DeepEqual(e.Files, tt.want) {
+				t.Errorf("Files = %q, want %q", e.Files, tt.want)
+			}
+			if strings.Contains(e.Summary, dir) {
+				t.Errorf("Summary keep folder path: %q", e.Summary)
+			}
+			if len(tt.record) > 0 && !strings.Contains(e.Summary, "<rec1.jpg>") {
+				t.Errorf("Summary without relative record file: %q", e.Summary)
+			}
+		})
+	}
+}
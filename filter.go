@@ -0,0 +1,69 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MessageFilter select decoded message, zero value match everything
+type MessageFilter struct {
+	// Types readable type name or kind like 49/57
+	Types map[string]bool
+	// States status or flag name like failed, revoked or forwarded
+	States  map[string]bool
+	From    string
+	Mention string
+	Grep    *regexp.Regexp
+}
+
+func parseTypes(value string) map[string]bool {
+	if value == "" {
+		return nil
+	}
+	types := make(map[string]bool)
+	parts := strings.Split(value, ",")
+	for i := 0; i < len(parts); i++ {
+		if part := strings.TrimSpace(parts[i]); part != "" {
+			types[part] = true
+		}
+	}
+	return types
+}
+
+// parseUntil date only value include the whole day
+func parseUntil(value string) (time.Time, error) {
+	until, err := parseDate(value)
+	if err == nil && len(value) == len("2006-01-02") {
+		until = until.AddDate(0, 0, 1)
+	}
+	return until, err
+}
+
+func (f *MessageFilter) Match(m *Message) bool {
+	if len(f.Types) > 0 && !f.Types[m.TypeName()] && !f.Types[m.Kind()] {
+		return false
+	}
+	if len(f.States) > 0 && !f.matchState(m) {
+		return false
+	}
+	if f.From != "" && !strings.EqualFold(m.Sender, f.From) && !strings.EqualFold(m.SenderName, f.From) {
+		return false
+	}
+	if f.Mention != "" && !m.Mentioned(f.Mention) {
+		return false
+	}
+	if f.Grep != nil && !f.Grep.MatchString(m.Summary()) {
+		return false
+	}
+	return true
+}
+
+func (f *MessageFilter) matchState(m *Message) bool {
+	for state := range f.States {
+		if m.HasState(state) {
+			return true
+		}
+	}
+	return false
+}
@@ -4,6 +4,7 @@ go 1.20
 
 require (
 	github.com/dustin/go-humanize v1.0.1
+	github.com/h2non/filetype v1.1.3
 	github.com/jedib0t/go-pretty/v6 v6.4.9
 	github.com/mattn/go-sqlite3 v1.14.18
 	github.com/urfave/cli/v2 v2.26.0
@@ -13,7 +14,6 @@ require (
 
 require (
 	github.com/cpuguy83/go-md2man/v2 v2.0.3 // indirect
-	github.com/h2non/filetype v1.1.3 // indirect
 	github.com/mattn/go-runewidth v0.0.15 // indirect
 	github.com/rivo/uniseg v0.4.4 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
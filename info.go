@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dustin/go-humanize"
+	"github.com/urfave/cli/v2"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var InfoCommand = &cli.Command{
+	Name:   "info",
+	Usage:  "backup overview and decoded config",
+	Action: actionInfo,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "db",
+			Usage:   "decrypted Backup.db file path",
+			Value:   "Backup.db",
+			Aliases: []string{"d"},
+		},
+		&cli.StringFlag{
+			Name:    "format",
+			Usage:   "output format table or json",
+			Value:   "table",
+			Aliases: []string{"f"},
+		},
+	},
+}
+
+type BackupOverview struct {
+	Owner        string
+	BackupTime   time.Time
+	Device       string
+	Version      string
+	Talkers      int
+	Sessions     int
+	Segments     int
+	MediaFiles   int
+	MessageBytes int64
+	MediaBytes   int64
+	TotalBytes   int64
+	// First Last time range covered by message segments
+	First time.Time
+	Last  time.Time
+	// OrphanTalkerIds segment talker id missing from Name2ID
+	OrphanTalkerIds []int
+	// ColumnGuesses unmatched column at position of missing known one, not read
+	ColumnGuesses []string
+	Config        []*ConfigEntry
+}
+
+func actionInfo(ctx *cli.Context) error {
+	dbName := ctx.String("db")
+	format := ctx.String("format")
+	switch format {
+	case "table", "json":
+	default:
+		return errors.New("unsupported format " + format)
+	}
+
+	db, err := NewBackupDB(dbName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	overview, err := db.Overview()
+	if err != nil {
+		return err
+	}
+	if overview.Config, err = db.Config(); err != nil {
+		return err
+	}
+	if overview.Owner, err = db.Owner(); err != nil {
+		return err
+	}
+	if db.Schema().HasColumn("MsgSegments", "TalkerId") {
+		if overview.OrphanTalkerIds, err = db.OrphanTalkerIds(); err != nil {
+			return err
+		}
+	}
+	tables := db.Schema().Tables
+	for i := 0; i < len(tables); i++ {
+		for j := 0; j < len(tables[i].Guesses); j++ {
+			g := tables[i].Guesses[j]
+			overview.ColumnGuesses = append(overview.ColumnGuesses, tables[i].Name+"."+g.Column+" maybe "+g.Field)
+		}
+	}
+	if e := configValue(overview.Config, "time", "date"); e != nil && e.Kind == "time" {
+		overview.BackupTime = e.Time
+	}
+	if e := configValue(overview.Config, "device"); e != nil {
+		overview.Device = e.Value
+		if len(e.Fields) > 0 {
+			overview.Device = e.Fields[0].Value
+		}
+	}
+	if e := configValue(overview.Config, "version"); e != nil {
+		overview.Version = e.Value
+	}
+
+	if format == "json" {
+		return writeJSON(os.Stdout, overview)
+	}
+
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format("2006-01-02 15:04:05")
+	}
+	bytes := func(n int64) string {
+		return fmt.Sprintf("%s (%d)", humanize.Bytes(uint64(n)), n)
+	}
+	t := newRowsTable([]string{"Item", "Value"}, [][]string{
+		{"Owner", overview.Owner},
+		{"Backup Date", formatTime(overview.BackupTime)},
+		{"Device", overview.Device},
+		{"Version", overview.Version},
+		{"Talkers", strconv.Itoa(overview.Talkers)},
+		{"Sessions", strconv.Itoa(overview.Sessions)},
+		{"Segments", strconv.Itoa(overview.Segments)},
+		{"Media Files", strconv.Itoa(overview.MediaFiles)},
+		{"Message Bytes", bytes(overview.MessageBytes)},
+		{"Media Bytes", bytes(overview.MediaBytes)},
+		{"Total Bytes", bytes(overview.TotalBytes)},
+		{"First Message", formatTime(overview.First)},
+		{"Last Message", formatTime(overview.Last)},
+	})
+	fmt.Println(t.Render())
+
+	if len(overview.OrphanTalkerIds) > 0 {
+		ids := make([]string, 0, len(overview.OrphanTalkerIds))
+		for i := 0; i < len(overview.OrphanTalkerIds); i++ {
+			ids = append(ids, strconv.Itoa(overview.OrphanTalkerIds[i]))
+		}
+		fmt.Fprintf(os.Stderr, "warning: message segments of talker id %s missing from Name2ID\n", strings.Join(ids, ", "))
+	}
+	for i := 0; i < len(overview.ColumnGuesses); i++ {
+		fmt.Fprintf(os.Stderr, "warning: column %s by position, not used\n", overview.ColumnGuesses[i])
+	}
+
+	if len(overview.Config) == 0 {
+		return nil
+	}
+	rows := make([][]string, 0, len(overview.Config))
+	for i := 0; i < len(overview.Config); i++ {
+		e := overview.Config[i]
+		rows = append(rows, []string{e.Key, e.Kind, e.Value})
+	}
+	fmt.Println(newRowsTable([]string{"Key", "Kind", "Value"}, rows).Render())
+	return nil
+}
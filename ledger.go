@@ -0,0 +1,519 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/urfave/cli/v2"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var LedgerCommand = &cli.Command{
+	Name:   "ledger",
+	Usage:  "list money transfer and red packet with per contact totals",
+	Action: actionLedger,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "db",
+			Usage:   "decrypted Backup.db file path",
+			Value:   "Backup.db",
+			Aliases: []string{"d"},
+		},
+		&cli.StringFlag{
+			Name:     "resource",
+			Usage:    "BAK_0_XXX folder path",
+			Required: true,
+			Aliases:  []string{"r"},
+		},
+		&cli.StringFlag{
+			Name:    "talker",
+			Usage:   "only list talker payments default all sessions",
+			Aliases: []string{"t"},
+		},
+		&cli.StringFlag{
+			Name:     "pass",
+			Usage:    "decrypt media resource file chunk key",
+			Required: true,
+			Aliases:  []string{"p"},
+		},
+		&cli.StringFlag{
+			Name:    "format",
+			Usage:   "output format table, csv or json",
+			Value:   "table",
+			Aliases: []string{"f"},
+		},
+		&cli.BoolFlag{
+			Name:  "totals",
+			Usage: "only output per contact totals for table and csv",
+		},
+		&cli.StringFlag{
+			Name:    "output",
+			Usage:   "output file default stdout",
+			Aliases: []string{"o"},
+		},
+	},
+}
+
+type PaymentKind int
+
+const (
+	PaymentTransfer PaymentKind = iota
+	PaymentRedPacket
+)
+
+func (k PaymentKind) String() string {
+	if k == PaymentRedPacket {
+		return "RedPacket"
+	}
+	return "Transfer"
+}
+
+func (k PaymentKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+type PaymentStatus int
+
+const (
+	PaymentSent PaymentStatus = iota
+	PaymentReceived
+	PaymentRefunded
+	PaymentExpired
+)
+
+func (s PaymentStatus) String() string {
+	switch s {
+	case PaymentReceived:
+		return "received"
+	case PaymentRefunded:
+		return "refunded"
+	case PaymentExpired:
+		return "expired"
+	}
+	return "sent"
+}
+
+func (s PaymentStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Settled money actually moved to receiver
+func (s PaymentStatus) Settled() bool {
+	return s == PaymentReceived
+}
+
+// Pending transfer waiting for receiver to accept
+func (s PaymentStatus) Pending() bool {
+	return s == PaymentSent
+}
+
+// Payment decoded type 49 app message 2000 transfer or 2001 red packet,
+// red packet message never carry amount
+type Payment struct {
+	Kind     PaymentKind
+	Id       string
+	MsgId    uint64
+	Talker   string
+	Payer    string
+	Receiver string
+	// Amount in cent, -1 means unknown
+	Amount   int64
+	Currency string
+	Memo     string
+	Status   PaymentStatus
+	Time     time.Time
+}
+
+var currencySymbols = []struct {
+	symbol, code string
+}{
+	{"HK$", "HKD"},
+	{"US$", "USD"},
+	{"￥", "CNY"},
+	{"¥", "CNY"},
+	{"$", "USD"},
+	{"€", "EUR"},
+	{"£", "GBP"},
+}
+
+// parseFee split fee description like "￥128.50" into cent and currency code
+func parseFee(fee string) (int64, string) {
+	fee = strings.TrimSpace(fee)
+	currency := "CNY"
+	for i := 0; i < len(currencySymbols); i++ {
+		if strings.HasPrefix(fee, currencySymbols[i].symbol) {
+			currency = currencySymbols[i].code
+			fee = fee[len(currencySymbols[i].symbol):]
+			break
+		}
+	}
+
+	fee = strings.TrimSuffix(strings.ReplaceAll(strings.TrimSpace(fee), ",", ""), "元")
+	if strings.IndexFunc(fee, unicode.IsDigit) < 0 {
+		return -1, currency
+	}
+	yuan, cent, _ := strings.Cut(fee, ".")
+	if len(cent) == 1 {
+		cent += "0"
+	}
+	if cent == "" {
+		cent = "00"
+	}
+	value, err := strconv.ParseInt(yuan+cent[:2], 10, 64)
+	if err != nil || len(cent) > 2 && strings.Trim(cent[2:], "0") != "" {
+		return -1, currency
+	}
+	return value, currency
+}
+
+func formatAmount(amount int64) string {
+	if amount < 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d.%02d", amount/100, amount%100)
+}
+
+func formatNet(amount int64) string {
+	if amount < 0 {
+		return "-" + formatAmount(-amount)
+	}
+	return formatAmount(amount)
+}
+
+func (m *Message) Payment() *Payment {
+	if m.Type != 49 || m.Xml == nil || m.Xml.AppMsg == nil || m.Xml.AppMsg.WcPayInfo == nil {
+		return nil
+	}
+	app := m.Xml.AppMsg
+	info := app.WcPayInfo
+
+	// counterpart of the sender, chatroom payment receiver is unknown
+	other := m.To
+	if isChatroom(m.Talker) {
+		other = m.Talker
+	}
+
+	p := &Payment{
+		MsgId:  m.Id,
+		Talker: m.Talker,
+		Amount: -1,
+		Time:   m.Time,
+	}
+
+	switch app.Type {
+	case 2000:
+		p.Kind = PaymentTransfer
+		p.Id = info.TransferId
+		if p.Id == "" {
+			p.Id = info.TranscationId
+		}
+		p.Memo = info.PayMemo
+		p.Amount, p.Currency = parseFee(info.FeeDesc)
+		// paysubtype 1 sent by payer, the others be answered by receiver
+		switch info.PaySubType {
+		case 3:
+			p.Status = PaymentReceived
+		case 4:
+			p.Status = PaymentRefunded
+		case 5, 8:
+			p.Status = PaymentExpired
+		}
+		if info.PaySubType == 1 {
+			p.Payer, p.Receiver = m.Sender, other
+		} else {
+			p.Payer, p.Receiver = other, m.Sender
+		}
+	case 2001:
+		p.Kind = PaymentRedPacket
+		p.Id = info.PayMsgId
+		p.Currency = "CNY"
+		p.Memo = info.ReceiverTitle
+		if p.Memo == "" {
+			p.Memo = app.Title
+		}
+		p.Payer, p.Receiver = m.Sender, other
+		if native, err := url.Parse(info.NativeURL); err == nil {
+			query := native.Query()
+			if p.Id == "" {
+				p.Id = query.Get("sendid")
+			}
+			if sender := query.Get("sendusername"); sender != "" {
+				p.Payer = sender
+			}
+		}
+	default:
+		return nil
+	}
+
+	if info.PayerUserName != "" {
+		p.Payer = info.PayerUserName
+	}
+	if info.ReceiverUserName != "" {
+		p.Receiver = info.ReceiverUserName
+	}
+
+	return p
+}
+
+// Outgoing owner paid
+func (p *Payment) Outgoing(owner string) bool {
+	return p.Payer == owner
+}
+
+// Contact counterpart of owner
+func (p *Payment) Contact(owner string) string {
+	if p.Outgoing(owner) {
+		return p.Receiver
+	}
+	return p.Payer
+}
+
+type Ledger struct {
+	owner    string
+	payments []*Payment
+	index    map[string]*Payment
+}
+
+type LedgerEntry struct {
+	*Payment
+	Direction   Direction
+	Contact     string
+	ContactName string
+}
+
+type LedgerTotal struct {
+	Contact     string
+	ContactName string
+	Currency    string
+	Count       int
+	RedPackets  int
+	// Paid Received and Net in cent of received transfer, refunded and expired excluded
+	Paid     int64
+	Received int64
+	Net      int64
+	// Pending in cent of transfer not accepted yet, either direction
+	Pending int64
+}
+
+func NewLedger(owner string) *Ledger {
+	return &Ledger{owner: owner, index: make(map[string]*Payment)}
+}
+
+// Add record payment, transfer state messages with same id be merged into latest status
+func (l *Ledger) Add(p *Payment) {
+	if p.Id == "" {
+		l.payments = append(l.payments, p)
+		return
+	}
+
+	key := p.Kind.String() + ":" + p.Id
+	exist, ok := l.index[key]
+	if !ok {
+		l.index[key] = p
+		l.payments = append(l.payments, p)
+		return
+	}
+
+	if p.Status != PaymentSent {
+		exist.Status = p.Status
+	}
+	if exist.Memo == "" {
+		exist.Memo = p.Memo
+	}
+	if exist.Amount < 0 {
+		exist.Amount, exist.Currency = p.Amount, p.Currency
+	}
+}
+
+func (l *Ledger) Entries(name func(string) string) []*LedgerEntry {
+	entries := make([]*LedgerEntry, 0, len(l.payments))
+	for i := 0; i < len(l.payments); i++ {
+		p := l.payments[i]
+		entry := &LedgerEntry{Payment: p, Direction: Incoming, Contact: p.Contact(l.owner)}
+		if p.Outgoing(l.owner) {
+			entry.Direction = Outgoing
+		}
+		entry.ContactName = name(entry.Contact)
+		entries = append(entries, entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	return entries
+}
+
+// Totals per contact and currency sorted by contact
+func (l *Ledger) Totals(name func(string) string) []*LedgerTotal {
+	totals := make(map[string]*LedgerTotal)
+	var keys []string
+	for i := 0; i < len(l.payments); i++ {
+		p := l.payments[i]
+		contact := p.Contact(l.owner)
+		currency := p.Currency
+		if currency == "" {
+			currency = "CNY"
+		}
+		key := contact + "\x00" + currency
+		total, ok := totals[key]
+		if !ok {
+			total = &LedgerTotal{Contact: contact, ContactName: name(contact), Currency: currency}
+			totals[key] = total
+			keys = append(keys, key)
+		}
+
+		total.Count++
+		if p.Kind == PaymentRedPacket {
+			total.RedPackets++
+		}
+		if p.Amount < 0 {
+			continue
+		}
+		if p.Status.Pending() {
+			total.Pending += p.Amount
+			continue
+		}
+		if !p.Status.Settled() {
+			continue
+		}
+		if p.Outgoing(l.owner) {
+			total.Paid += p.Amount
+		} else {
+			total.Received += p.Amount
+		}
+		total.Net = total.Received - total.Paid
+	}
+
+	sort.Strings(keys)
+	result := make([]*LedgerTotal, 0, len(keys))
+	for i := 0; i < len(keys); i++ {
+		result = append(result, totals[keys[i]])
+	}
+	return result
+}
+
+func ledgerEntryRow(e *LedgerEntry) []string {
+	return []string{
+		e.Time.Format("2006-01-02 15:04:05"),
+		e.Kind.String(),
+		e.Direction.String(),
+		e.Contact,
+		e.ContactName,
+		formatAmount(e.Amount),
+		e.Currency,
+		e.Status.String(),
+		e.Memo,
+		e.Id,
+		strconv.FormatUint(e.MsgId, 10),
+	}
+}
+
+var ledgerEntryHeader = []string{"Time", "Kind", "Direction", "Contact", "Name", "Amount", "Currency", "Status", "Memo", "Id", "MsgId"}
+
+func ledgerTotalRow(t *LedgerTotal) []string {
+	return []string{
+		t.Contact,
+		t.ContactName,
+		t.Currency,
+		strconv.Itoa(t.Count),
+		strconv.Itoa(t.RedPackets),
+		formatAmount(t.Paid),
+		formatAmount(t.Received),
+		formatNet(t.Net),
+		formatAmount(t.Pending),
+	}
+}
+
+var ledgerTotalHeader = []string{"Contact", "Name", "Currency", "Count", "RedPackets", "Paid", "Received", "Net", "Pending"}
+
+func actionLedger(ctx *cli.Context) error {
+	dbName := ctx.String("db")
+	resource := ctx.String("resource")
+	talker := ctx.String("talker")
+	pass := Pass(ctx.String("pass"))
+	format := ctx.String("format")
+	onlyTotals := ctx.Bool("totals")
+	output := ctx.String("output")
+	if !pass.Valid() {
+		return ErrInvalidPassKey
+	}
+	if format != "table" && format != "csv" && format != "json" {
+		return errors.New("unsupported format " + format)
+	}
+
+	defer releaseFds()
+
+	db, err := NewBackupDB(dbName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	book, err := NewContactBook(db)
+	if err != nil {
+		return err
+	}
+
+	talkers, err := selectTalkers(db, talker)
+	if err != nil {
+		return err
+	}
+
+	owner, err := detectOwner(db, resource, pass)
+	if err != nil {
+		return err
+	}
+
+	var payments []*Payment
+	for i := 0; i < len(talkers); i++ {
+		messages, err := loadMessages(db, resource, pass, talkers[i], book, LoadOptions{Owner: owner})
+		if err != nil {
+			return err
+		}
+		for j := 0; j < len(messages); j++ {
+			if payment := messages[j].Payment(); payment != nil {
+				payments = append(payments, payment)
+			}
+		}
+	}
+
+	ledger := NewLedger(owner)
+	for i := 0; i < len(payments); i++ {
+		ledger.Add(payments[i])
+	}
+	entries := ledger.Entries(book.Name)
+	totals := ledger.Totals(book.Name)
+
+	w, err := createOutput(output)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if format == "json" {
+		return writeJSON(w, struct {
+			Owner    string
+			Payments []*LedgerEntry
+			Totals   []*LedgerTotal
+		}{owner, entries, totals})
+	}
+
+	header, rows := ledgerEntryHeader, make([][]string, 0, len(entries))
+	for i := 0; i < len(entries); i++ {
+		rows = append(rows, ledgerEntryRow(entries[i]))
+	}
+	if onlyTotals {
+		header, rows = ledgerTotalHeader, make([][]string, 0, len(totals))
+		for i := 0; i < len(totals); i++ {
+			rows = append(rows, ledgerTotalRow(totals[i]))
+		}
+	}
+
+	if format == "csv" {
+		return writeCSV(w, header, rows)
+	}
+	return writeTable(w, header, rows)
+}
@@ -0,0 +1,71 @@
+package main
+
+import "testing"
+
+func TestParseFee(t *testing.T) {
+	tests := []struct {
+		fee      string
+		amount   int64
+		currency string
+	}{
+		{"￥128.50", 12850, "CNY"},
+		{"¥0.01", 1, "CNY"},
+		{"￥1,000.5", 100050, "CNY"},
+		{"￥20", 2000, "CNY"},
+		{"20.00元", 2000, "CNY"},
+		{" ￥ 3.10 ", 310, "CNY"},
+		{"HK$50.00", 5000, "HKD"},
+		{"US$1.99", 199, "USD"},
+		{"$2", 200, "USD"},
+		{"€7.5", 750, "EUR"},
+		{"£0.30", 30, "GBP"},
+		{"￥1.230", 123, "CNY"},
+		{"￥1.234", -1, "CNY"},
+		{"", -1, "CNY"},
+		{"￥", -1, "CNY"},
+		{"￥.", -1, "CNY"},
+		{"HK$", -1, "HKD"},
+		{"free", -1, "CNY"},
+		{"￥12a", -1, "CNY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fee, func(t *testing.T) {
+			amount, currency := parseFee(tt.fee)
+			if amount != tt.amount || currency != tt.currency {
+				t.Errorf("parseFee(%q) = %d %s, want %d %s", tt.fee, amount, currency, tt.amount, tt.currency)
+			}
+		})
+	}
+}
+
+func TestLedgerTotals(t *testing.T) {
+	ledger := NewLedger("me")
+	for _, p := range []*Payment{
+		// sent then accepted, merged into one received transfer
+		{Kind: PaymentTransfer, Id: "t1", Payer: "me", Receiver: "bob", Amount: 1000, Currency: "CNY", Status: PaymentSent},
+		{Kind: PaymentTransfer, Id: "t1", Payer: "me", Receiver: "bob", Amount: 1000, Currency: "CNY", Status: PaymentReceived},
+		// never accepted
+		{Kind: PaymentTransfer, Id: "t2", Payer: "bob", Receiver: "me", Amount: 500, Currency: "CNY", Status: PaymentSent},
+		{Kind: PaymentTransfer, Id: "t3", Payer: "bob", Receiver: "me", Amount: 300, Currency: "CNY", Status: PaymentReceived},
+		{Kind: PaymentTransfer, Id: "t4", Payer: "me", Receiver: "bob", Amount: 700, Currency: "CNY", Status: PaymentRefunded},
+		{Kind: PaymentTransfer, Id: "t5", Payer: "me", Receiver: "bob", Amount: 900, Currency: "CNY", Status: PaymentExpired},
+		{Kind: PaymentTransfer, Id: "t6", Payer: "me", Receiver: "bob", Amount: -1, Currency: "CNY", Status: PaymentReceived},
+		{Kind: PaymentRedPacket, Id: "r1", Payer: "bob", Receiver: "me", Amount: -1, Currency: "CNY"},
+	} {
+		ledger.Add(p)
+	}
+
+	totals := ledger.Totals(func(user string) string { return user })
+	if len(totals) != 1 {
+		t.Fatalf("got %d totals, want 1", len(totals))
+	}
+	got := *totals[0]
+	want := LedgerTotal{
+		Contact: "bob", ContactName: "bob", Currency: "CNY",
+		Count: 7, RedPackets: 1,
+		Paid: 1000, Received: 300, Net: -700, Pending: 500,
+	}
+	if got != want {
+		t.Errorf("totals = %+v, want %+v", got, want)
+	}
+}
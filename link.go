@@ -0,0 +1,345 @@
+package main
+
+import (
+	"errors"
+	"github.com/urfave/cli/v2"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var LinksCommand = &cli.Command{
+	Name:   "links",
+	Usage:  "catalog shared link, article, applet and music",
+	Action: actionLinks,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "db",
+			Usage:   "decrypted Backup.db file path",
+			Value:   "Backup.db",
+			Aliases: []string{"d"},
+		},
+		&cli.StringFlag{
+			Name:     "resource",
+			Usage:    "BAK_0_XXX folder path",
+			Required: true,
+			Aliases:  []string{"r"},
+		},
+		&cli.StringFlag{
+			Name:    "talker",
+			Usage:   "only list talker links default all sessions",
+			Aliases: []string{"t"},
+		},
+		&cli.StringFlag{
+			Name:     "pass",
+			Usage:    "decrypt media resource file chunk key",
+			Required: true,
+			Aliases:  []string{"p"},
+		},
+		&cli.StringFlag{
+			Name:    "format",
+			Usage:   "output format table, csv, json or html bookmarks",
+			Value:   "table",
+			Aliases: []string{"f"},
+		},
+		&cli.StringFlag{
+			Name:    "output",
+			Usage:   "output file default stdout",
+			Aliases: []string{"o"},
+		},
+	},
+}
+
+// Link shared url, first share keep sender and time
+type Link struct {
+	Kind       string
+	URL        string
+	Title      string
+	Desc       string
+	Source     string
+	SourceUser string
+	ThumbURL   string
+	MsgId      uint64
+	Talker     string
+	Sender     string
+	SenderName string
+	Time       time.Time
+	// Shares times the url be shared
+	Shares   int
+	LastTime time.Time
+}
+
+func linkKind(appType int) string {
+	switch appType {
+	case 4, 5:
+		return "link"
+	case 33:
+		return "applet"
+	case 36:
+		return "app"
+	case 3, 76:
+		return "music"
+	}
+	return ""
+}
+
+// Link shared url of type 49 app message
+func (m *Message) Link() *Link {
+	if m.Type != 49 || m.Xml == nil || m.Xml.AppMsg == nil {
+		return nil
+	}
+	app := m.Xml.AppMsg
+	kind := linkKind(app.Type)
+	if kind == "" {
+		return nil
+	}
+
+	link := &Link{
+		Kind:       kind,
+		URL:        app.URL,
+		Title:      app.Title,
+		Desc:       app.Desc,
+		Source:     app.SourceDisplayName,
+		SourceUser: app.SourceUserName,
+		ThumbURL:   app.ThumbURL,
+		MsgId:      m.Id,
+		Talker:     m.Talker,
+		Sender:     m.Sender,
+		SenderName: m.SenderName,
+		Time:       m.Time,
+	}
+	if link.Source == "" && m.Xml.AppInfo != nil {
+		link.Source = m.Xml.AppInfo.AppName
+	}
+	// applet page without web fallback
+	if link.URL == "" && app.WeAppInfo != nil && app.WeAppInfo.AppId != "" {
+		link.URL = "weapp://" + app.WeAppInfo.AppId + "/" + app.WeAppInfo.PagePath
+	}
+	if link.URL == "" {
+		link.URL = app.DataURL
+	}
+	if link.URL == "" {
+		return nil
+	}
+	return link
+}
+
+type LinkCatalog struct {
+	links []*Link
+	index map[string]*Link
+}
+
+func NewLinkCatalog() *LinkCatalog {
+	return &LinkCatalog{index: make(map[string]*Link)}
+}
+
+func (c *LinkCatalog) Add(link *Link) {
+	exist, ok := c.index[link.URL]
+	if !ok {
+		link.Shares = 1
+		link.LastTime = link.Time
+		c.index[link.URL] = link
+		c.links = append(c.links, link)
+		return
+	}
+
+	exist.Shares++
+	if link.Time.After(exist.LastTime) {
+		exist.LastTime = link.Time
+	}
+	if link.Time.Before(exist.Time) {
+		exist.MsgId, exist.Talker, exist.Sender, exist.SenderName, exist.Time =
+			link.MsgId, link.Talker, link.Sender, link.SenderName, link.Time
+	}
+}
+
+// addRecord collect link items of merged forward message
+func (c *LinkCatalog) addRecord(m *Message) {
+	_ = m.Record.Walk(func(item *RecordItem) error {
+		if item.DataType != RecordLink || item.URL == "" {
+			return nil
+		}
+		seen := item.Time
+		if seen.IsZero() {
+			seen = m.Time
+		}
+		c.Add(&Link{
+			Kind:       "link",
+			URL:        item.URL,
+			Title:      item.Title,
+			Desc:       item.Text,
+			MsgId:      m.Id,
+			Talker:     m.Talker,
+			SenderName: item.Sender,
+			Time:       seen,
+		})
+		return nil
+	})
+}
+
+func (c *LinkCatalog) Links() []*Link {
+	return c.links
+}
+
+var linkHeader = []string{"Time", "Kind", "Title", "Source", "Sender", "Talker", "Shares", "URL"}
+
+func linkRow(link *Link) []string {
+	return []string{
+		link.Time.Format("2006-01-02 15:04:05"),
+		link.Kind,
+		link.Title,
+		link.Source,
+		link.SenderName,
+		link.Talker,
+		strconv.Itoa(link.Shares),
+		link.URL,
+	}
+}
+
+var linkCSVHeader = []string{"Time", "Kind", "Title", "Description", "Source", "SourceUser", "Sender", "SenderName", "Talker", "Shares", "LastTime", "URL", "MsgId"}
+
+func linkCSVRow(link *Link) []string {
+	return []string{
+		link.Time.Format("2006-01-02 15:04:05"),
+		link.Kind,
+		link.Title,
+		link.Desc,
+		link.Source,
+		link.SourceUser,
+		link.Sender,
+		link.SenderName,
+		link.Talker,
+		strconv.Itoa(link.Shares),
+		link.LastTime.Format("2006-01-02 15:04:05"),
+		link.URL,
+		strconv.FormatUint(link.MsgId, 10),
+	}
+}
+
+// bookmarksTemplate netscape bookmark file, importable by most browser
+var bookmarksTemplate = template.Must(template.New("bookmarks").Funcs(template.FuncMap{
+	"unix": func(t time.Time) int64 {
+		return t.Unix()
+	},
+}).Parse(`<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+{{- range .}}
+    <DT><H3>{{.Name}}</H3>
+    <DL><p>
+    {{- range .Links}}
+        <DT><A HREF="{{.URL}}" ADD_DATE="{{unix .Time}}">{{if .Title}}{{.Title}}{{else}}{{.URL}}{{end}}</A>
+        {{- if .Desc}}
+        <DD>{{.Desc}}
+        {{- end}}
+    {{- end}}
+    </DL><p>
+{{- end}}
+</DL><p>
+`))
+
+type bookmarkFolder struct {
+	Name  string
+	Links []*Link
+}
+
+// writeBookmarks group links by kind, applet page without web url be skipped
+func writeBookmarks(w io.Writer, links []*Link) error {
+	var folders []*bookmarkFolder
+	index := make(map[string]*bookmarkFolder)
+	for i := 0; i < len(links); i++ {
+		if !strings.HasPrefix(links[i].URL, "http://") && !strings.HasPrefix(links[i].URL, "https://") {
+			continue
+		}
+		folder, ok := index[links[i].Kind]
+		if !ok {
+			folder = &bookmarkFolder{Name: links[i].Kind}
+			index[links[i].Kind] = folder
+			folders = append(folders, folder)
+		}
+		folder.Links = append(folder.Links, links[i])
+	}
+	return bookmarksTemplate.Execute(w, folders)
+}
+
+func actionLinks(ctx *cli.Context) error {
+	dbName := ctx.String("db")
+	resource := ctx.String("resource")
+	talker := ctx.String("talker")
+	pass := Pass(ctx.String("pass"))
+	format := ctx.String("format")
+	output := ctx.String("output")
+	if !pass.Valid() {
+		return ErrInvalidPassKey
+	}
+	switch format {
+	case "table", "csv", "json", "html":
+	default:
+		return errors.New("unsupported format " + format)
+	}
+
+	defer releaseFds()
+
+	db, err := NewBackupDB(dbName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	book, err := NewContactBook(db)
+	if err != nil {
+		return err
+	}
+
+	talkers, err := selectTalkers(db, talker)
+	if err != nil {
+		return err
+	}
+
+	catalog := NewLinkCatalog()
+	for i := 0; i < len(talkers); i++ {
+		messages, err := loadMessages(db, resource, pass, talkers[i], book, LoadOptions{})
+		if err != nil {
+			return err
+		}
+		for j := 0; j < len(messages); j++ {
+			m := messages[j]
+			if link := m.Link(); link != nil {
+				catalog.Add(link)
+			}
+			if m.Record != nil {
+				catalog.addRecord(m)
+			}
+		}
+	}
+
+	w, err := createOutput(output)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	links := catalog.Links()
+	switch format {
+	case "json":
+		return writeJSON(w, links)
+	case "html":
+		return writeBookmarks(w, links)
+	case "csv":
+		rows := make([][]string, 0, len(links))
+		for i := 0; i < len(links); i++ {
+			rows = append(rows, linkCSVRow(links[i]))
+		}
+		return writeCSV(w, linkCSVHeader, rows)
+	}
+
+	rows := make([][]string, 0, len(links))
+	for i := 0; i < len(links); i++ {
+		rows = append(rows, linkRow(links[i]))
+	}
+	return writeTable(w, linkHeader, rows)
+}
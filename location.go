@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"github.com/urfave/cli/v2"
+	"io"
+	"strconv"
+	"time"
+)
+
+var LocationsCommand = &cli.Command{
+	Name:   "locations",
+	Usage:  "export shared locations as GeoJSON or KML",
+	Action: actionLocations,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "db",
+			Usage:   "decrypted Backup.db file path",
+			Value:   "Backup.db",
+			Aliases: []string{"d"},
+		},
+		&cli.StringFlag{
+			Name:     "resource",
+			Usage:    "BAK_0_XXX folder path",
+			Required: true,
+			Aliases:  []string{"r"},
+		},
+		&cli.StringFlag{
+			Name:    "talker",
+			Usage:   "only export talker locations default all sessions",
+			Aliases: []string{"t"},
+		},
+		&cli.StringFlag{
+			Name:     "pass",
+			Usage:    "decrypt media resource file chunk key",
+			Required: true,
+			Aliases:  []string{"p"},
+		},
+		&cli.StringFlag{
+			Name:    "format",
+			Usage:   "output format geojson or kml",
+			Value:   "geojson",
+			Aliases: []string{"f"},
+		},
+		&cli.StringFlag{
+			Name:    "output",
+			Usage:   "output file default stdout",
+			Aliases: []string{"o"},
+		},
+	},
+}
+
+// Location coordinate as WeChat shared, GCJ-02 inside mainland China
+type Location struct {
+	Lat     float64
+	Lon     float64
+	Scale   float64
+	Label   string
+	POIName string
+	POIId   string
+	InfoURL string
+}
+
+func (m *Message) Location() *Location {
+	if m.Type != 48 || m.Xml == nil || m.Xml.Location == nil {
+		return nil
+	}
+	l := m.Xml.Location
+	return &Location{
+		Lat:     l.X,
+		Lon:     l.Y,
+		Scale:   l.Scale,
+		Label:   l.Label,
+		POIName: l.POIName,
+		POIId:   l.POIId,
+		InfoURL: l.InfoURL,
+	}
+}
+
+type SharedLocation struct {
+	*Location
+	Id         uint64
+	Talker     string
+	TalkerName string
+	Sender     string
+	SenderName string
+	Direction  Direction
+	Time       time.Time
+}
+
+func (l *SharedLocation) Name() string {
+	if l.POIName != "" {
+		return l.POIName
+	}
+	return l.Label
+}
+
+type geoJSONFeature struct {
+	Type       string         `json:"type"`
+	Geometry   geoJSONPoint   `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+type geoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+type geoJSONCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+func writeGeoJSON(w io.Writer, locations []*SharedLocation) error {
+	collection := geoJSONCollection{Type: "FeatureCollection", Features: []geoJSONFeature{}}
+	for i := 0; i < len(locations); i++ {
+		l := locations[i]
+		collection.Features = append(collection.Features, geoJSONFeature{
+			Type: "Feature",
+			Geometry: geoJSONPoint{
+				Type:        "Point",
+				Coordinates: [2]float64{l.Lon, l.Lat},
+			},
+			Properties: map[string]any{
+				"id":         strconv.FormatUint(l.Id, 10),
+				"name":       l.Name(),
+				"label":      l.Label,
+				"poiName":    l.POIName,
+				"poiId":      l.POIId,
+				"scale":      l.Scale,
+				"time":       l.Time.Format(time.RFC3339),
+				"talker":     l.Talker,
+				"talkerName": l.TalkerName,
+				"sender":     l.Sender,
+				"senderName": l.SenderName,
+				"direction":  l.Direction.String(),
+			},
+		})
+	}
+
+	return writeJSON(w, collection)
+}
+
+type kmlTimeStamp struct {
+	When string `xml:"when"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlPlacemark struct {
+	Name        string       `xml:"name"`
+	Description string       `xml:"description"`
+	TimeStamp   kmlTimeStamp `xml:"TimeStamp"`
+	Point       kmlPoint     `xml:"Point"`
+}
+
+type kmlDocument struct {
+	Name       string         `xml:"name"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlRoot struct {
+	XMLName  xml.Name    `xml:"http://www.opengis.net/kml/2.2 kml"`
+	Document kmlDocument `xml:"Document"`
+}
+
+func writeKML(w io.Writer, locations []*SharedLocation) error {
+	root := kmlRoot{Document: kmlDocument{Name: "WeChat shared locations"}}
+	for i := 0; i < len(locations); i++ {
+		l := locations[i]
+		root.Document.Placemarks = append(root.Document.Placemarks, kmlPlacemark{
+			Name:        l.Name(),
+			Description: l.Label + "\n" + l.SenderName + " @ " + l.TalkerName,
+			TimeStamp:   kmlTimeStamp{When: l.Time.Format(time.RFC3339)},
+			Point: kmlPoint{
+				Coordinates: strconv.FormatFloat(l.Lon, 'f', -1, 64) + "," + strconv.FormatFloat(l.Lat, 'f', -1, 64),
+			},
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(root); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func actionLocations(ctx *cli.Context) error {
+	dbName := ctx.String("db")
+	resource := ctx.String("resource")
+	talker := ctx.String("talker")
+	pass := Pass(ctx.String("pass"))
+	format := ctx.String("format")
+	output := ctx.String("output")
+	if !pass.Valid() {
+		return ErrInvalidPassKey
+	}
+
+	var write func(io.Writer, []*SharedLocation) error
+	switch format {
+	case "geojson":
+		write = writeGeoJSON
+	case "kml":
+		write = writeKML
+	default:
+		return errors.New("unsupported format " + format)
+	}
+
+	defer releaseFds()
+
+	db, err := NewBackupDB(dbName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	book, err := NewContactBook(db)
+	if err != nil {
+		return err
+	}
+
+	talkers, err := selectTalkers(db, talker)
+	if err != nil {
+		return err
+	}
+
+	owner, err := detectOwner(db, resource, pass)
+	if err != nil {
+		return err
+	}
+
+	var locations []*SharedLocation
+	for i := 0; i < len(talkers); i++ {
+		messages, err := loadMessages(db, resource, pass, talkers[i], book, LoadOptions{Owner: owner})
+		if err != nil {
+			return err
+		}
+		for j := 0; j < len(messages); j++ {
+			m := messages[j]
+			location := m.Location()
+			if location == nil {
+				continue
+			}
+			locations = append(locations, &SharedLocation{
+				Location:   location,
+				Id:         m.Id,
+				Talker:     m.Talker,
+				TalkerName: book.Name(m.Talker),
+				Sender:     m.Sender,
+				SenderName: m.SenderName,
+				Direction:  m.Direction,
+				Time:       m.Time,
+			})
+		}
+	}
+
+	w, err := createOutput(output)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	return write(w, locations)
+}
@@ -22,6 +22,16 @@ func main() {
 			ChatCommand,
 			DecryptCommand,
 			ResourcesCommand,
+			EmojiCommand,
+			ContactsCommand,
+			LocationsCommand,
+			LedgerCommand,
+			CallsCommand,
+			LinksCommand,
+			StatsCommand,
+			ExportCommand,
+			InfoCommand,
+			SchemaCommand,
 		},
 	}
 
@@ -0,0 +1,751 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/anonymous5l/wcdb/protobuf"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func mkdirIfNotExist(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return os.MkdirAll(path, 0755)
+		}
+		return err
+	}
+	return nil
+}
+
+func readSegment(resource string, pass Pass, segment MsgSegment) (*protobuf.BakChatMsgList, error) {
+	bakFile := getFd(filepath.Join(resource, segment.FilePath))
+	if bakFile == nil {
+		return nil, errors.New("missing BAK file " + segment.FilePath)
+	}
+
+	if _, err := bakFile.Seek(segment.OffSet, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, segment.Length, segment.Length)
+
+	dataSize, err := bakFile.Read(data)
+	if err != nil {
+		return nil, err
+	}
+	if dataSize != len(data) {
+		return nil, errors.New("invalid BAK file")
+	}
+
+	if data, err = aesDecrypt([]byte(pass), data, true); err != nil {
+		return nil, err
+	}
+
+	var messages protobuf.BakChatMsgList
+	if err = proto.Unmarshal(data, &messages); err != nil {
+		return nil, err
+	}
+
+	return &messages, nil
+}
+
+// walkMessages decrypt every message segment of talker in order
+func walkMessages(db *BackupDB, resource string, pass Pass, talkerId int, fn func(message *protobuf.BakChatMsgItem) error) error {
+	return walkMessageRange(db, resource, pass, talkerId, time.Time{}, time.Time{}, fn)
+}
+
+// walkMessageRange skip segment entirely out of [since, until) without decrypting, zero time means unbounded
+func walkMessageRange(db *BackupDB, resource string, pass Pass, talkerId int, since, until time.Time, fn func(message *protobuf.BakChatMsgItem) error) error {
+	segments, err := db.MsgSegment(talkerId)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(segments); i++ {
+		segment := segments[i]
+		// segment time has second precision, message may be later in same second
+		if !since.IsZero() && segment.EndTime > 0 && unixTime(int64(segment.EndTime)).Add(time.Second).Before(since) {
+			continue
+		}
+		if !until.IsZero() && segment.StartTime > 0 && !unixTime(int64(segment.StartTime)).Before(until) {
+			continue
+		}
+
+		messages, err := readSegment(resource, pass, segment)
+		if err != nil {
+			return err
+		}
+
+		list := messages.GetList()
+		for j := 0; j < int(messages.GetCount()) && j < len(list); j++ {
+			if err = fn(list[j]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// referDepth limit nested quote decoding
+const referDepth = 3
+
+type Message struct {
+	Id       uint64
+	Type     uint32
+	Talker   string
+	From     string
+	To       string
+	Time     time.Time
+	Content  string
+	MediaIds []string
+	// Buffer inline data of item, thumbnail or voice which may not be in MsgMedia
+	Buffer []byte
+
+	Source *XmlMsgSource
+	// Mentions @ user list, notify@all for mention everyone
+	Mentions []string
+
+	// Sender actual sender, differ from From in chatroom
+	Sender     string
+	SenderName string
+	// Direction Outgoing when sent by backup owner
+	Direction Direction
+
+	Status MessageStatus
+	Flags  MessageFlags
+	// RawStatus Flag BufferType SequentId kept as stored in backup
+	RawStatus  uint32
+	Flag       uint32
+	BufferType uint32
+	SequentId  uint32
+
+	Xml      *XmlMessage
+	NameCard *XmlNameCard
+	VoIP     *XmlVoIP
+	OldVoIP  *XmlOldVoIP
+	Record   *Record
+	SysMsg   *XmlSysMsg
+	Event    *SystemEvent
+
+	// Refer quoted message decoded from refermsg
+	Refer *Message
+	// ReplyTo original message of Refer in same conversation
+	ReplyTo *Message
+
+	// Files dumped local attachment path
+	Files []string
+
+	// Err decode failure, message keep raw content
+	Err error
+}
+
+// newMessage decode message, failure be recorded in Err instead of abort
+func newMessage(talker string, item *protobuf.BakChatMsgItem) *Message {
+	m := &Message{
+		Id:      item.GetNewMsgId(),
+		Type:    item.GetType(),
+		Talker:  talker,
+		From:    item.GetFromUserName().GetStr(),
+		To:      item.GetToUserName().GetStr(),
+		Time:    time.UnixMilli(item.GetClientMsgMillTime()),
+		Content: item.GetContent().GetStr(),
+
+		Status:     parseMessageStatus(item.GetMsgStatus()),
+		RawStatus:  item.GetMsgStatus(),
+		Flag:       item.GetMsgFlag(),
+		BufferType: item.GetBufferType(),
+		SequentId:  item.GetSequentId(),
+	}
+
+	if buffer := item.GetBuffer(); buffer != nil {
+		m.Buffer = buffer.GetBuffer()
+		if n := int(buffer.GetLen()); n > 0 && n < len(m.Buffer) {
+			m.Buffer = m.Buffer[:n]
+		}
+	}
+
+	ids := item.GetMediaId()
+	for i := 0; i < len(ids); i++ {
+		m.MediaIds = append(m.MediaIds, ids[i].GetStr())
+	}
+
+	if source := item.GetMsgSource(); strings.HasPrefix(source, "<msgsource") {
+		// broken msgSource only lose mentions, content still decode
+		var xmlSource XmlMsgSource
+		if err := xml.Unmarshal([]byte(source), &xmlSource); err == nil {
+			m.Source = &xmlSource
+			m.Mentions = splitMentions(xmlSource.AtUserList)
+		}
+	}
+
+	m.Sender = m.From
+	if isChatroom(talker) && m.From == talker {
+		if sender, content, ok := splitSender(m.Content); ok {
+			m.Sender = sender
+			m.Content = content
+		}
+	}
+
+	if err := m.decode(0); err != nil {
+		m.Err = err
+	}
+	m.decodeFlags()
+
+	return m
+}
+
+func missingElement(name string) error {
+	return errors.New("missing <" + name + "> element")
+}
+
+func (m *Message) decode(depth int) (err error) {
+	// 10000 be contacts notify message
+	// 1 text message
+	// 3 image
+	// 34 voice message
+	// 47 emoji
+	// 62 short video
+	// 50 voip message
+	// 48 location
+	// 76 qq music
+	// 3 netease music
+	// 4 red book
+	// 42 name card
+	// 19 group join refer message
+	// 49 composite message
+	//   type - 6 - file
+	//   type - 57 - refer message
+	//   type - 33 - applet
+	//   type - 36 - app share
+	//   type - 17 - realtime location share
+	//   type - 2000 - money transfer
+	//   type - 2001 - lucky money
+	// 62 tickle
+	content := m.Content
+
+	switch m.Type {
+	case 42:
+		var xmlMessage XmlNameCard
+		if err = xml.Unmarshal([]byte(content), &xmlMessage); err != nil {
+			return err
+		}
+		m.NameCard = &xmlMessage
+	case 49, 48, 47, 43, 3:
+		var xmlMessage XmlMessage
+		if err = xml.Unmarshal([]byte(content), &xmlMessage); err != nil {
+			return err
+		}
+		m.Xml = &xmlMessage
+		switch {
+		case m.Type == 49 && xmlMessage.AppMsg == nil:
+			return missingElement("appmsg")
+		case m.Type == 49:
+			return m.decodeAppMessage(depth)
+		case m.Type == 48 && xmlMessage.Location == nil:
+			return missingElement("location")
+		case m.Type == 47 && xmlMessage.Emoji == nil:
+			return missingElement("emoji")
+		case m.Type == 43 && xmlMessage.Video == nil:
+			return missingElement("videomsg")
+		case m.Type == 3 && xmlMessage.Image == nil:
+			return missingElement("img")
+		}
+	case 34:
+		if strings.HasPrefix(content, "<msg>") {
+			var xmlMessage XmlMessage
+			if err = xml.Unmarshal([]byte(content), &xmlMessage); err != nil {
+				return err
+			}
+			if xmlMessage.Voice == nil {
+				return missingElement("voicemsg")
+			}
+			m.Xml = &xmlMessage
+		}
+	case 10000:
+		m.Event = parseNotice(content)
+	case 10002:
+		if strings.HasPrefix(content, "<sysmsg") {
+			var sysMsg XmlSysMsg
+			if err = xml.Unmarshal([]byte(content), &sysMsg); err != nil {
+				return err
+			}
+			m.SysMsg = &sysMsg
+			m.Event = parseSysMsg(&sysMsg)
+		} else {
+			m.Event = parseNotice(content)
+		}
+	case 50:
+		if strings.HasPrefix(content, "<voipinvitemsg>") {
+			var voip XmlOldVoIP
+			if err = xml.Unmarshal([]byte("<xml>"+content+"</xml>"), &voip); err != nil {
+				return err
+			}
+			m.OldVoIP = &voip
+		} else {
+			var voip XmlVoIP
+			if err = xml.Unmarshal([]byte(content), &voip); err != nil {
+				return err
+			}
+			if voip.VoIPBubbleMsg == nil {
+				return missingElement("VoIPBubbleMsg")
+			}
+			m.VoIP = &voip
+		}
+	}
+
+	return nil
+}
+
+func (m *Message) decodeAppMessage(depth int) (err error) {
+	app := m.Xml.AppMsg
+
+	switch app.Type {
+	case 19:
+		if app.RecordItem != nil {
+			if m.Record, err = decodeRecord(app.Title, app.RecordItem.Value, m.Time); err != nil {
+				return err
+			}
+		}
+	case 57:
+		if app.ReferMsg != nil && depth < referDepth {
+			m.Refer = newReferMessage(m.Talker, app.ReferMsg, depth+1)
+		}
+	}
+
+	return nil
+}
+
+// newReferMessage decode quoted message, failure only affect quote itself
+func newReferMessage(talker string, refer *XmlAppMessageRefer, depth int) *Message {
+	m := &Message{
+		Id:      refer.SvrId,
+		Type:    uint32(refer.Type),
+		Talker:  talker,
+		From:    refer.FromUsr,
+		Content: refer.Content,
+	}
+	if m.From == "" {
+		m.From = refer.ChatUsr
+	}
+	if refer.CreateTime > 0 {
+		m.Time = time.Unix(refer.CreateTime, 0)
+	}
+
+	// quoted app message content is appmsg without msg wrapper
+	if m.Type == 49 && strings.HasPrefix(m.Content, "<appmsg") {
+		m.Content = "<msg>" + m.Content + "</msg>"
+	}
+
+	if err := m.decode(depth); err != nil {
+		m.Err = err
+	}
+
+	return m
+}
+
+const MentionAll = "notify@all"
+
+func splitMentions(list string) []string {
+	var mentions []string
+	users := strings.Split(list, ",")
+	for i := 0; i < len(users); i++ {
+		if user := strings.TrimSpace(users[i]); user != "" {
+			mentions = append(mentions, user)
+		}
+	}
+	return mentions
+}
+
+// Mentioned message @ user or everyone
+func (m *Message) Mentioned(user string) bool {
+	for i := 0; i < len(m.Mentions); i++ {
+		if m.Mentions[i] == user || m.Mentions[i] == MentionAll {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Message) Silence() bool {
+	return m.Source != nil && m.Source.Silence != 0
+}
+
+func isChatroom(talker string) bool {
+	return strings.HasSuffix(talker, "@chatroom")
+}
+
+// splitSender split chatroom message content "wxid_xxx:\n" prefix
+func splitSender(content string) (string, string, bool) {
+	i := strings.Index(content, ":\n")
+	if i <= 0 {
+		return "", content, false
+	}
+	sender := content[:i]
+	if strings.ContainsAny(sender, " \t\n<>\"") {
+		return "", content, false
+	}
+	return sender, content[i+2:], true
+}
+
+// selectTalkers resolve given talker or every session talker own messages
+func selectTalkers(db *BackupDB, talker string) ([]string, error) {
+	if talker != "" {
+		username, err := resolveTalker(db, talker)
+		if err != nil {
+			return nil, err
+		}
+		return []string{username}, nil
+	}
+
+	sessions, err := db.Sessions()
+	if err != nil {
+		return nil, err
+	}
+
+	var talkers []string
+	for i := 0; i < len(sessions); i++ {
+		// session without any message
+		if _, err = db.TalkerId(sessions[i].Talker); err == ErrNoTalker {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		talkers = append(talkers, sessions[i].Talker)
+	}
+	return talkers, nil
+}
+
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseDate parse command line date in local time zone
+func parseDate(value string) (time.Time, error) {
+	for i := 0; i < len(dateLayouts); i++ {
+		if t, err := time.ParseInLocation(dateLayouts[i], value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("invalid date " + value + ", expect 2006-01-02 [15:04[:05]]")
+}
+
+type LoadOptions struct {
+	// Strict abort on first undecodable message
+	Strict bool
+	// Since Until only load message in [Since, Until), zero means unbounded
+	Since time.Time
+	Until time.Time
+	// Owner backup account decide message direction, see detectOwner
+	Owner string
+}
+
+// loadMessages decode all talker messages, link quote to original message and resolve sender name by book
+func loadMessages(db *BackupDB, resource string, pass Pass, talker string, book *ContactBook, opts LoadOptions) ([]*Message, error) {
+	talkerId, err := db.TalkerId(talker)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []*Message
+	if err = walkMessageRange(db, resource, pass, talkerId, opts.Since, opts.Until, func(item *protobuf.BakChatMsgItem) error {
+		t := time.UnixMilli(item.GetClientMsgMillTime())
+		if !opts.Since.IsZero() && t.Before(opts.Since) || !opts.Until.IsZero() && !t.Before(opts.Until) {
+			return nil
+		}
+		m := newMessage(talker, item)
+		if opts.Strict && m.Err != nil {
+			return fmt.Errorf("message %d type %d: %w", m.Id, m.Type, m.Err)
+		}
+		messages = append(messages, m)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	ids := make(map[uint64]*Message, len(messages))
+	for i := 0; i < len(messages); i++ {
+		ids[messages[i].Id] = messages[i]
+		book.Observe(messages[i])
+	}
+	for i := 0; i < len(messages); i++ {
+		m := messages[i]
+		if m.Refer != nil && m.Refer.Id != 0 {
+			m.ReplyTo = ids[m.Refer.Id]
+		}
+		m.SenderName = book.Name(m.Sender)
+		m.Direction = messageDirection(m, opts.Owner)
+		if m.Event != nil {
+			m.Event.Resolve(book.Name)
+			if revoked := ids[m.Event.MsgId]; m.Event.Kind == EventRevoke && revoked != nil {
+				revoked.Status = StatusRevoked
+			}
+		}
+	}
+
+	return messages, nil
+}
+
+var knownTypes = map[uint32]bool{
+	1: true, 3: true, 34: true, 42: true, 43: true, 47: true,
+	48: true, 49: true, 50: true, 10000: true, 10002: true,
+}
+
+var knownAppTypes = map[int]bool{
+	3: true, 4: true, 5: true, 6: true, 19: true, 33: true,
+	36: true, 57: true, 62: true, 76: true, 2000: true, 2001: true,
+}
+
+// Kind type key distinguish app message type, eg 49/57
+func (m *Message) Kind() string {
+	kind := strconv.FormatUint(uint64(m.Type), 10)
+	if m.Type == 49 && m.Xml != nil && m.Xml.AppMsg != nil {
+		kind += "/" + strconv.Itoa(m.Xml.AppMsg.Type)
+	}
+	return kind
+}
+
+var typeNames = map[uint32]string{
+	1: "text", 3: "image", 34: "voice", 42: "namecard", 43: "video", 47: "emoji",
+	48: "location", 50: "call", 10000: "system", 10002: "system",
+}
+
+var appTypeNames = map[int]string{
+	3: "music", 4: "link", 5: "link", 6: "file", 19: "record", 33: "applet",
+	36: "app", 57: "quote", 62: "tickle", 76: "music", 2000: "transfer", 2001: "redpacket",
+}
+
+// TypeName readable type, unknown one fallback to Kind
+func (m *Message) TypeName() string {
+	if m.Type == 49 && m.Xml != nil && m.Xml.AppMsg != nil {
+		if name, ok := appTypeNames[m.Xml.AppMsg.Type]; ok {
+			return name
+		}
+	} else if name, ok := typeNames[m.Type]; ok {
+		return name
+	}
+	return m.Kind()
+}
+
+func (m *Message) Unknown() bool {
+	if !knownTypes[m.Type] {
+		return true
+	}
+	return m.Err == nil && m.Type == 49 && !knownAppTypes[m.Xml.AppMsg.Type]
+}
+
+type DecodeStats struct {
+	Malformed map[string]int
+	Unknown   map[string]int
+}
+
+func newDecodeStats(messages []*Message) *DecodeStats {
+	stats := &DecodeStats{
+		Malformed: make(map[string]int),
+		Unknown:   make(map[string]int),
+	}
+	for i := 0; i < len(messages); i++ {
+		m := messages[i]
+		if m.Err != nil {
+			stats.Malformed[m.Kind()]++
+		} else if m.Unknown() {
+			stats.Unknown[m.Kind()]++
+		}
+	}
+	return stats
+}
+
+func (s *DecodeStats) Empty() bool {
+	return len(s.Malformed) == 0 && len(s.Unknown) == 0
+}
+
+func (s *DecodeStats) String() string {
+	strs := bytes.NewBufferString("undecodable messages:")
+	for _, group := range []struct {
+		name   string
+		counts map[string]int
+	}{{"malformed", s.Malformed}, {"unknown", s.Unknown}} {
+		kinds := make([]string, 0, len(group.counts))
+		for kind := range group.counts {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for i := 0; i < len(kinds); i++ {
+			strs.WriteString("\n  ")
+			strs.WriteString(group.name)
+			strs.WriteString(" type ")
+			strs.WriteString(kinds[i])
+			strs.WriteString(": ")
+			strs.WriteString(strconv.Itoa(group.counts[kinds[i]]))
+		}
+	}
+	return strs.String()
+}
+
+func (m *Message) Summary() string {
+	strs := bytes.NewBufferString("")
+
+	if m.Err != nil {
+		strs.WriteString("[Malformed ")
+		strs.WriteString(strconv.FormatUint(uint64(m.Type), 10))
+		strs.WriteString(": ")
+		strs.WriteString(m.Err.Error())
+		strs.WriteString("] ")
+		strs.WriteString(m.Content)
+		return strs.String()
+	}
+
+	switch m.Type {
+	case 42:
+		strs.WriteString("[NameCard: ")
+		strs.WriteString(m.NameCard.NickName)
+		strs.WriteString("]")
+	case 49:
+		app := m.Xml.AppMsg
+		if app == nil {
+			break
+		}
+		switch app.Type {
+		case 19:
+			printRecord(strs, m.Record, "")
+		case 62:
+			strs.WriteString("[Tickle]")
+		case 57:
+			strs.WriteString(app.Title)
+			strs.WriteString(" [Refer")
+			if m.ReplyTo != nil {
+				strs.WriteString(" #")
+				strs.WriteString(strconv.FormatUint(m.ReplyTo.Id, 10))
+			}
+			strs.WriteString(": ")
+			if app.ReferMsg != nil {
+				strs.WriteString(app.ReferMsg.DisplayName)
+				strs.WriteString(":")
+			}
+			if m.Refer != nil {
+				strs.WriteString(m.Refer.Summary())
+			}
+			strs.WriteString("]")
+		case 33:
+			strs.WriteString("[Applet: ")
+			strs.WriteString(app.Title)
+			strs.WriteString("]")
+		case 36:
+			strs.WriteString("[App: ")
+			strs.WriteString(app.Title)
+			strs.WriteString("]")
+		case 4, 5:
+			strs.WriteString("[Link: ")
+			strs.WriteString(app.Title)
+			strs.WriteString("]")
+		case 76, 3:
+			strs.WriteString("[Music: ")
+			strs.WriteString(app.Title)
+			strs.WriteString("]")
+		case 6:
+			strs.WriteString("[File: ")
+			strs.WriteString(app.Title)
+			strs.WriteString("]")
+		case 2001, 2000:
+			payment := m.Payment()
+			if payment == nil {
+				strs.WriteString("[" + app.Title + "]")
+				break
+			}
+			strs.WriteString("[")
+			strs.WriteString(payment.Kind.String())
+			strs.WriteString(": ")
+			if payment.Amount >= 0 {
+				strs.WriteString(payment.Currency)
+				strs.WriteString(" ")
+				strs.WriteString(formatAmount(payment.Amount))
+				strs.WriteString(" ")
+			}
+			strs.WriteString(payment.Status.String())
+			if payment.Memo != "" {
+				strs.WriteString(" \"")
+				strs.WriteString(payment.Memo)
+				strs.WriteString("\"")
+			}
+			strs.WriteString("]")
+		default:
+			strs.WriteString(m.Content)
+		}
+	case 48:
+		location := m.Location()
+		strs.WriteString("[Location: ")
+		if location.POIName != "" && location.POIName != location.Label {
+			strs.WriteString(location.POIName)
+			strs.WriteString(", ")
+		}
+		strs.WriteString(location.Label)
+		strs.WriteString(" (")
+		strs.WriteString(strconv.FormatFloat(location.Lat, 'f', 6, 64))
+		strs.WriteString(", ")
+		strs.WriteString(strconv.FormatFloat(location.Lon, 'f', 6, 64))
+		strs.WriteString(")]")
+	case 47:
+		strs.WriteString("[Emoji: ")
+		strs.WriteString(m.Xml.Emoji.MD5)
+		strs.WriteString("]")
+	case 34:
+		if m.Xml != nil {
+			strs.WriteString("[Voice: ")
+			strs.WriteString(strconv.FormatFloat(float64(m.Xml.Voice.VoiceLength)/1000, 'f', 1, 64))
+			strs.WriteByte('s')
+			strs.WriteString("]")
+		} else {
+			strs.WriteString("[Voice]")
+		}
+	case 43:
+		strs.WriteString("[Video: ")
+		strs.WriteString(strconv.FormatInt(int64(m.Xml.Video.PlayLength), 10))
+		strs.WriteByte('s')
+		strs.WriteString("]")
+	case 50:
+		call := m.Call()
+		if call.Kind == CallVoice {
+			strs.WriteString("[VoiceCall: ")
+		} else {
+			strs.WriteString("[VideoCall: ")
+		}
+		switch call.Outcome {
+		case CallAnswered:
+			strs.WriteString(strconv.FormatInt(int64(call.Duration.Seconds()), 10))
+			strs.WriteString("s")
+		case CallUnknown:
+			strs.WriteString(call.Text)
+		default:
+			strs.WriteString(call.Outcome.String())
+		}
+		strs.WriteString("]")
+	case 3:
+		strs.WriteString("[Image: ")
+		strs.WriteString(m.Xml.Image.MD5)
+		strs.WriteString("]")
+	case 10000, 10002:
+		strs.WriteString("[System: ")
+		strs.WriteString(m.Event.String())
+		strs.WriteString("]")
+	case 1:
+		strs.WriteString(m.Content)
+	default:
+		strs.WriteString(strconv.FormatUint(uint64(m.Type), 10))
+		strs.WriteString(":")
+		strs.WriteString(m.Content)
+	}
+
+	return strs.String()
+}
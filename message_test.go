@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"github.com/anonymous5l/wcdb/protobuf"
+	"google.golang.org/protobuf/proto"
+	"reflect"
+	"testing"
+)
+
+func newTestItem(msgType uint32, content, source string) *protobuf.BakChatMsgItem {
+	return &protobuf.BakChatMsgItem{
+		Type:              proto.Uint32(msgType),
+		FromUserName:      &protobuf.SKBuiltinString{Str: proto.String("wxid_a")},
+		ToUserName:        &protobuf.SKBuiltinString{Str: proto.String("wxid_me")},
+		Content:           &protobuf.SKBuiltinString{Str: proto.String(content)},
+		MsgSource:         proto.String(source),
+		NewMsgId:          proto.Uint64(1),
+		ClientMsgMillTime: proto.Int64(1700000000000),
+	}
+}
+
+func TestNewMessageSource(t *testing.T) {
+	tests := []struct {
+		name      string
+		msgType   uint32
+		content   string
+		source    string
+		malformed bool
+		parsed    bool
+		mentions  []string
+	}{
+		{"no source", 1, "hi", "", false, false, nil},
+		{"mentions", 1, "@Bob hi", "<msgsource><atuserlist>wxid_b, notify@all</atuserlist></msgsource>", false, true, []string{"wxid_b", "notify@all"}},
+		{"broken source keep text", 1, "hi", "<msgsource><atuserlist>wxid_b</msgsource>", false, false, nil},
+		{"broken source keep decoded content", 48, `<msg><location x="1" y="2" label="here"/></msg>`, "<msgsource><silence>1", false, false, nil},
+		{"broken content", 48, "<msg><location", "", true, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMessage("wxid_a", newTestItem(tt.msgType, tt.content, tt.source))
+			if (m.Err != nil) != tt.malformed {
+				t.Errorf("Err = %v, want malformed %v", m.Err, tt.malformed)
+			}
+			if (m.Source != nil) != tt.parsed {
+				t.Errorf("Source = %v, want parsed %v", m.Source, tt.parsed)
+			}
+			if !reflect.DeepEqual(m.Mentions, tt.mentions) {
+				t.Errorf("Mentions = %q, want %q", m.Mentions, tt.mentions)
+			}
+			stats := newDecodeStats([]*Message{m})
+			if got := len(stats.Malformed) > 0; got != tt.malformed {
+				t.Errorf("counted malformed %v, want %v", got, tt.malformed)
+			}
+		})
+	}
+}
+
+func TestNewMessageBuffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		buffer *protobuf.SKBuiltinBuffer
+		want   []byte
+	}{
+		{"no buffer", nil, nil},
+		{"length match", &protobuf.SKBuiltinBuffer{Len: proto.Uint32(3), Buffer: []byte("abc")}, []byte("abc")},
+		{"padding cut by length", &protobuf.SKBuiltinBuffer{Len: proto.Uint32(2), Buffer: []byte("abc")}, []byte("ab")},
+		{"length over data", &protobuf.SKBuiltinBuffer{Len: proto.Uint32(9), Buffer: []byte("abc")}, []byte("abc")},
+		{"zero length keep data", &protobuf.SKBuiltinBuffer{Len: proto.Uint32(0), Buffer: []byte("abc")}, []byte("abc")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := newTestItem(34, "", "")
+			item.Buffer = tt.buffer
+			if m := newMessage("wxid_a", item); !bytes.Equal(m.Buffer, tt.want) {
+				t.Errorf("Buffer = %q, want %q", m.Buffer, tt.want)
+			}
+		})
+	}
+}
@@ -10,7 +10,7 @@ type Config struct {
 	Reserved0 sql.NullInt64
 	Buf       []byte
 	Reserved1 sql.NullInt64
-	Reserved2 string
+	Reserved2 sql.NullString
 }
 
 type MsgFileSegment struct {
@@ -137,6 +137,35 @@ type XmlAppMessage struct {
 	DirectShare       int                 `xml:"directshare,omitempty"`
 	RecordItem        *cdata              `xml:"recorditem,omitempty"`
 	ReferMsg          *XmlAppMessageRefer `xml:"refermsg,omitempty"`
+	WcPayInfo         *XmlWcPayInfo       `xml:"wcpayinfo,omitempty"`
+	WeAppInfo         *XmlWeAppInfo       `xml:"weappinfo,omitempty"`
+}
+
+type XmlWeAppInfo struct {
+	XMLName      xml.Name `xml:"weappinfo"`
+	UserName     string   `xml:"username"`
+	AppId        string   `xml:"appid"`
+	PagePath     string   `xml:"pagepath"`
+	WeAppIconURL string   `xml:"weappiconurl"`
+}
+
+type XmlWcPayInfo struct {
+	XMLName           xml.Name `xml:"wcpayinfo"`
+	PaySubType        int      `xml:"paysubtype"`
+	FeeDesc           string   `xml:"feedesc"`
+	TranscationId     string   `xml:"transcationid"`
+	TransferId        string   `xml:"transferid"`
+	InvalidTime       int64    `xml:"invalidtime"`
+	BeginTransferTime int64    `xml:"begintransfertime"`
+	PayMemo           string   `xml:"pay_memo"`
+	PayerUserName     string   `xml:"payer_username"`
+	ReceiverUserName  string   `xml:"receiver_username"`
+	ReceiverTitle     string   `xml:"receivertitle"`
+	SenderTitle       string   `xml:"sendertitle"`
+	SceneText         string   `xml:"scenetext"`
+	NativeURL         string   `xml:"nativeurl"`
+	PayMsgId          string   `xml:"paymsgid"`
+	InnerType         int      `xml:"innertype"`
 }
 
 type XmlAppInfo struct {
@@ -281,6 +310,27 @@ type XmlRecordMessageDataItemSource struct {
 	HashUsername string   `xml:"hashusername"`
 }
 
+type XmlRecordWebURLItem struct {
+	XMLName  xml.Name `xml:"weburlitem"`
+	CleanURL string   `xml:"clean_url"`
+	Title    string   `xml:"title"`
+	Desc     string   `xml:"desc"`
+}
+
+type XmlRecordLocItem struct {
+	XMLName xml.Name `xml:"locitem"`
+	Lat     float64  `xml:"lat"`
+	Lng     float64  `xml:"lng"`
+	Scale   float64  `xml:"scale"`
+	Label   string   `xml:"label"`
+	POIName string   `xml:"poiname"`
+}
+
+type XmlRecordXml struct {
+	XMLName    xml.Name          `xml:"recordxml"`
+	RecordInfo *XmlRecordMessage `xml:"recordinfo"`
+}
+
 type XmlRecordMessageDataItem struct {
 	XMLName          xml.Name                        `xml:"dataitem"`
 	DataDesc         string                          `xml:"datadesc"`
@@ -300,6 +350,11 @@ type XmlRecordMessageDataItem struct {
 	AppId            string                          `xml:"appid"`
 	DataItemSource   *XmlRecordMessageDataItemSource `xml:"dataitemsource,omitempty"`
 	FileType         int                             `xml:"filetype"`
+	Duration         int                             `xml:"duration"`
+	Link             string                          `xml:"link"`
+	WebURLItem       *XmlRecordWebURLItem            `xml:"weburlitem,omitempty"`
+	LocItem          *XmlRecordLocItem               `xml:"locitem,omitempty"`
+	RecordXml        *XmlRecordXml                   `xml:"recordxml,omitempty"`
 }
 
 type XmlRecordMessageDataList struct {
@@ -381,3 +436,74 @@ type XmlOldVoIP struct {
 	VoIPExtInfo   XmlVoIPExtInfo   `xml:"voipextinfo"`
 	VoIPLocalInfo XmlVoIPLocalInfo `xml:"voiplocalinfo"`
 }
+
+type XmlSysMsgMember struct {
+	XMLName  xml.Name `xml:"member"`
+	UserName string   `xml:"username"`
+	NickName string   `xml:"nickname"`
+}
+
+type XmlSysMsgLink struct {
+	XMLName    xml.Name          `xml:"link"`
+	Name       string            `xml:"name,attr"`
+	Type       string            `xml:"type,attr"`
+	MemberList []XmlSysMsgMember `xml:"memberlist>member"`
+	Separator  string            `xml:"separator"`
+	Title      string            `xml:"title"`
+	UserNames  []string          `xml:"username"`
+}
+
+type XmlSysMsgContentTemplate struct {
+	XMLName  xml.Name        `xml:"content_template"`
+	Type     string          `xml:"type,attr"`
+	Plain    string          `xml:"plain"`
+	Template string          `xml:"template"`
+	LinkList []XmlSysMsgLink `xml:"link_list>link"`
+}
+
+type XmlSysMsgTemplate struct {
+	XMLName         xml.Name                  `xml:"sysmsgtemplate"`
+	ContentTemplate *XmlSysMsgContentTemplate `xml:"content_template"`
+}
+
+type XmlSysMsgRevoke struct {
+	XMLName    xml.Name `xml:"revokemsg"`
+	Session    string   `xml:"session"`
+	MsgId      uint64   `xml:"msgid"`
+	NewMsgId   uint64   `xml:"newmsgid"`
+	ReplaceMsg string   `xml:"replacemsg"`
+}
+
+type XmlSysMsgPat struct {
+	XMLName        xml.Name `xml:"pat"`
+	FromUserName   string   `xml:"fromusername"`
+	ChatUserName   string   `xml:"chatusername"`
+	PattedUserName string   `xml:"pattedusername"`
+	PatSuffix      string   `xml:"patsuffix"`
+	Template       string   `xml:"template"`
+}
+
+type XmlSysMsg struct {
+	XMLName        xml.Name           `xml:"sysmsg"`
+	Type           string             `xml:"type,attr"`
+	SysMsgTemplate *XmlSysMsgTemplate `xml:"sysmsgtemplate,omitempty"`
+	RevokeMsg      *XmlSysMsgRevoke   `xml:"revokemsg,omitempty"`
+	Pat            *XmlSysMsgPat      `xml:"pat,omitempty"`
+}
+
+type XmlMsgSourceAlNode struct {
+	XMLName   xml.Name `xml:"alnode"`
+	Fr        int      `xml:"fr"`
+	Cf        int      `xml:"cf"`
+	InLenList string   `xml:"inlenlist"`
+}
+
+type XmlMsgSource struct {
+	XMLName     xml.Name            `xml:"msgsource"`
+	AtUserList  string              `xml:"atuserlist"`
+	Silence     int                 `xml:"silence"`
+	MemberCount int                 `xml:"membercount"`
+	Signature   string              `xml:"signature"`
+	BizFlag     int                 `xml:"bizflag"`
+	AlNode      *XmlMsgSourceAlNode `xml:"alnode,omitempty"`
+}
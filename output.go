@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"io"
+	"os"
+)
+
+type stdout struct {
+	io.Writer
+}
+
+func (stdout) Close() error {
+	return nil
+}
+
+// createOutput create file or stdout when name is empty
+func createOutput(name string) (io.WriteCloser, error) {
+	if name == "" {
+		return stdout{os.Stdout}, nil
+	}
+	return os.Create(name)
+}
+
+func newTable() table.Writer {
+	style := table.StyleDefault
+	style.Name = "CustomTable"
+	style.Format.Header = text.FormatDefault
+	style.Format.Footer = text.FormatDefault
+
+	t := table.NewWriter()
+	t.SetStyle(style)
+	return t
+}
+
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func writeCSV(w io.Writer, header []string, rows [][]string) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+func newRowsTable(header []string, rows [][]string) table.Writer {
+	t := newTable()
+	headerRow := make(table.Row, 0, len(header))
+	for i := 0; i < len(header); i++ {
+		headerRow = append(headerRow, header[i])
+	}
+	t.AppendHeader(headerRow)
+	for i := 0; i < len(rows); i++ {
+		row := make(table.Row, 0, len(rows[i]))
+		for j := 0; j < len(rows[i]); j++ {
+			row = append(row, rows[i][j])
+		}
+		t.AppendRow(row)
+	}
+	return t
+}
+
+func writeTable(w io.Writer, header []string, rows [][]string) error {
+	_, err := fmt.Fprintln(w, newRowsTable(header, rows).Render())
+	return err
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/anonymous5l/wcdb/protobuf"
+)
+
+// ownerVotes stop counting ToUserName once one account reach it
+const ownerVotes = 200
+
+// Direction of message from owner point of view
+type Direction int
+
+const (
+	Incoming Direction = iota
+	Outgoing
+)
+
+func (d Direction) String() string {
+	if d == Outgoing {
+		return "out"
+	}
+	return "in"
+}
+
+func (d Direction) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// segmentOwner UsrName shared by segments of several talkers must be the owner
+func (db *BackupDB) segmentOwner() (string, error) {
+	cols, err := db.schema.columnNames("MsgSegments", "UsrName", "TalkerId")
+	if err != nil {
+		return "", err
+	}
+	var name string
+	var talkers int
+	err = db.db.QueryRow("SELECT "+cols[0]+", COUNT(DISTINCT "+cols[1]+") AS n FROM MsgSegments "+
+		"WHERE "+cols[0]+" IS NOT NULL AND "+cols[0]+" != '' GROUP BY 1 ORDER BY n DESC LIMIT 1").Scan(&name, &talkers)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+	if talkers < 2 {
+		return "", nil
+	}
+	return name, nil
+}
+
+// Owner backup account username recorded by Config or segment UsrName, empty when unknown,
+// Config error only returned when segments do not tell either
+func (db *BackupDB) Owner() (string, error) {
+	entries, configErr := db.Config()
+	if owner := configOwner(entries); owner != "" {
+		return owner, nil
+	}
+	if db.schema.HasColumn("MsgSegments", "UsrName") {
+		owner, err := db.segmentOwner()
+		if err != nil || owner != "" {
+			return owner, err
+		}
+	}
+	return "", configErr
+}
+
+var errOwnerFound = errors.New("owner found")
+
+// messageOwner most frequent counterpart of talker in FromUserName and ToUserName
+func messageOwner(db *BackupDB, resource string, pass Pass) (string, error) {
+	talkers, err := selectTalkers(db, "")
+	if err != nil {
+		return "", err
+	}
+	votes := make(map[string]int)
+	owner := ""
+	for i := 0; i < len(talkers); i++ {
+		talker := talkers[i]
+		talkerId, err := db.TalkerId(talker)
+		if err != nil {
+			return "", err
+		}
+		err = walkMessages(db, resource, pass, talkerId, func(item *protobuf.BakChatMsgItem) error {
+			from, to := item.GetFromUserName().GetStr(), item.GetToUserName().GetStr()
+			candidate := from
+			if from == talker {
+				candidate = to
+			}
+			if candidate == "" || candidate == talker {
+				return nil
+			}
+			votes[candidate]++
+			if owner == "" || votes[candidate] > votes[owner] {
+				owner = candidate
+			}
+			if votes[owner] >= ownerVotes {
+				return errOwnerFound
+			}
+			return nil
+		})
+		if err == errOwnerFound {
+			break
+		} else if err != nil {
+			return "", err
+		}
+	}
+	return owner, nil
+}
+
+// detectOwner owner by Config, segment UsrName then ToUserName statistic
+func detectOwner(db *BackupDB, resource string, pass Pass) (string, error) {
+	// unreadable Config or segments still leave message voting
+	if owner, err := db.Owner(); err == nil && owner != "" {
+		return owner, nil
+	}
+	return messageOwner(db, resource, pass)
+}
+
+// messageDirection Sender decide direction, fallback to From when owner unknown
+func messageDirection(m *Message, owner string) Direction {
+	if owner != "" {
+		if m.Sender == owner {
+			return Outgoing
+		}
+		return Incoming
+	}
+	if m.From != "" && m.From != m.Talker {
+		return Outgoing
+	}
+	return Incoming
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recordDepth limit nested merged forward decoding
+const recordDepth = 8
+
+const (
+	RecordText     = 1
+	RecordImage    = 2
+	RecordVoice    = 3
+	RecordVideo    = 4
+	RecordLink     = 5
+	RecordLocation = 6
+	RecordMusic    = 7
+	RecordFile     = 8
+	RecordNameCard = 16
+	RecordRecord   = 17
+	RecordApplet   = 19
+)
+
+type Record struct {
+	Title string
+	Desc  string
+	Items []*RecordItem
+}
+
+type RecordItem struct {
+	DataType int
+	Sender   string
+	Time     time.Time
+	Text     string
+	Title    string
+	URL      string
+	Format   string
+	Size     int
+	Duration int
+	DataId   string
+	FullMD5  string
+	Location *XmlRecordLocItem
+	// Record nested merged forward
+	Record *Record
+
+	// File dumped local attachment path
+	File string
+}
+
+func decodeRecordInfo(value string) (*XmlRecordMessage, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "<recorditem>") {
+		var combine XmlMessageRecordItem
+		if err := xml.Unmarshal([]byte(value), &combine); err != nil {
+			return nil, err
+		}
+		return combine.RecordInfo, nil
+	} else if strings.HasPrefix(value, "<recordinfo>") {
+		var combine XmlRecordMessage
+		if err := xml.Unmarshal([]byte(value), &combine); err != nil {
+			return nil, err
+		}
+		return &combine, nil
+	}
+	return nil, nil
+}
+
+// decodeRecord sent is time of enclosing message, year of source time without one come from it
+func decodeRecord(title, value string, sent time.Time) (*Record, error) {
+	info, err := decodeRecordInfo(value)
+	if err != nil {
+		return nil, err
+	}
+	return newRecord(title, info, 0, sent), nil
+}
+
+func newRecord(title string, info *XmlRecordMessage, depth int, sent time.Time) *Record {
+	record := &Record{Title: title}
+	if info == nil {
+		return record
+	}
+
+	record.Desc = info.Desc
+	if info.DataList == nil {
+		return record
+	}
+
+	items := info.DataList.DataItems
+	for i := 0; i < len(items); i++ {
+		record.Items = append(record.Items, newRecordItem(&items[i], depth, sent))
+	}
+
+	return record
+}
+
+var sourceTimeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006/1/2 15:04:05",
+	"2006/1/2 15:04",
+}
+
+// sourceTimeNoYear layout of source time within current year
+const sourceTimeNoYear = "1/2 15:04"
+
+// parseSourceTime time of forwarded item, source time without year take year of sent,
+// one year earlier when that would be after sent, zero when sent unknown
+func parseSourceTime(item *XmlRecordMessageDataItem, sent time.Time) time.Time {
+	if item.SrcMsgCreateTime > 0 {
+		return time.Unix(item.SrcMsgCreateTime, 0)
+	}
+	value := strings.TrimSpace(item.SourceTime)
+	for i := 0; i < len(sourceTimeLayouts); i++ {
+		if t, err := time.ParseInLocation(sourceTimeLayouts[i], value, time.Local); err == nil {
+			return t
+		}
+	}
+	t, err := time.ParseInLocation(sourceTimeNoYear, value, time.Local)
+	if err != nil || sent.IsZero() {
+		return time.Time{}
+	}
+	sent = sent.In(time.Local)
+	t = time.Date(sent.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.Local)
+	if t.After(sent) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t
+}
+
+func newRecordItem(data *XmlRecordMessageDataItem, depth int, sent time.Time) *RecordItem {
+	item := &RecordItem{
+		DataType: data.DataType,
+		Sender:   data.SourceName,
+		Time:     parseSourceTime(data, sent),
+		Text:     data.DataDesc,
+		Title:    data.DataTitle,
+		URL:      data.Link,
+		Format:   data.DataFmt,
+		Size:     data.DataSize,
+		Duration: data.Duration,
+		DataId:   data.DataId,
+		FullMD5:  data.FullMD5,
+		Location: data.LocItem,
+	}
+
+	if data.WebURLItem != nil {
+		if item.URL == "" {
+			item.URL = data.WebURLItem.CleanURL
+		}
+		if item.Title == "" {
+			item.Title = data.WebURLItem.Title
+		}
+	}
+
+	if data.DataType == RecordRecord && data.RecordXml != nil && depth < recordDepth {
+		item.Record = newRecord(item.Title, data.RecordXml.RecordInfo, depth+1, sent)
+	}
+
+	return item
+}
+
+// Walk visit every item include nested record
+func (r *Record) Walk(fn func(item *RecordItem) error) error {
+	if r == nil {
+		return nil
+	}
+	for i := 0; i < len(r.Items); i++ {
+		item := r.Items[i]
+		if err := fn(item); err != nil {
+			return err
+		}
+		if err := item.Record.Walk(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (item *RecordItem) Summary() string {
+	strs := bytes.NewBufferString("")
+
+	switch item.DataType {
+	case RecordText:
+		strs.WriteString(item.Text)
+	case RecordImage:
+		strs.WriteString("[Image]")
+	case RecordVoice:
+		strs.WriteString("[Voice]")
+	case RecordVideo:
+		strs.WriteString("[Video")
+		if item.Duration > 0 {
+			strs.WriteString(": ")
+			strs.WriteString(strconv.Itoa(item.Duration))
+			strs.WriteByte('s')
+		}
+		strs.WriteString("]")
+	case RecordLink:
+		strs.WriteString("[Link: ")
+		strs.WriteString(item.Title)
+		if item.URL != "" {
+			strs.WriteString(" ")
+			strs.WriteString(item.URL)
+		}
+		strs.WriteString("]")
+	case RecordLocation:
+		strs.WriteString("[Location: ")
+		if item.Location != nil {
+			strs.WriteString(item.Location.Label)
+		} else {
+			strs.WriteString(item.Text)
+		}
+		strs.WriteString("]")
+	case RecordFile:
+		strs.WriteString("[File: ")
+		strs.WriteString(item.Title)
+		strs.WriteString("]")
+	default:
+		if item.Text != "" {
+			strs.WriteString(item.Text)
+		} else {
+			strs.WriteString(item.Title)
+		}
+	}
+
+	if item.File != "" {
+		strs.WriteString(" <")
+		strs.WriteString(item.File)
+		strs.WriteString(">")
+	}
+
+	return strs.String()
+}
+
+func printRecord(strs *bytes.Buffer, record *Record, indent string) {
+	if record == nil || len(record.Items) == 0 {
+		strs.WriteString("[CombineMessage]")
+		return
+	}
+
+	strs.WriteString("[CombineMessage")
+	if record.Title != "" {
+		strs.WriteString(": ")
+		strs.WriteString(record.Title)
+	}
+	strs.WriteString("\n")
+	for i := 0; i < len(record.Items); i++ {
+		item := record.Items[i]
+		strs.WriteString(indent)
+		strs.WriteString("  ")
+		strs.WriteString(item.Sender)
+		if !item.Time.IsZero() {
+			strs.WriteString(" (")
+			strs.WriteString(item.Time.Format("2006-01-02 15:04:05"))
+			strs.WriteString(")")
+		}
+		strs.WriteString(" : ")
+		if item.Record != nil {
+			printRecord(strs, item.Record, indent+"  ")
+		} else {
+			strs.WriteString(item.Summary())
+		}
+		strs.WriteString("\n")
+	}
+	strs.WriteString(indent)
+	strs.WriteString("]")
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSourceTime(t *testing.T) {
+	sent := time.Date(2023, 11, 20, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		name string
+		item XmlRecordMessageDataItem
+		sent time.Time
+		want time.Time
+	}{
+		{"create time", XmlRecordMessageDataItem{SrcMsgCreateTime: 1700000000}, sent, time.Unix(1700000000, 0)},
+		{"create time win over source time", XmlRecordMessageDataItem{SrcMsgCreateTime: 1700000000, SourceTime: "2020-01-02 03:04:05"}, sent, time.Unix(1700000000, 0)},
+		{"seconds", XmlRecordMessageDataItem{SourceTime: "2023-11-15 08:09:10"}, sent, time.Date(2023, 11, 15, 8, 9, 10, 0, time.Local)},
+		{"minutes", XmlRecordMessageDataItem{SourceTime: "2023-11-15 08:09"}, sent, time.Date(2023, 11, 15, 8, 9, 0, 0, time.Local)},
+		{"slash seconds", XmlRecordMessageDataItem{SourceTime: "2023/1/5 18:30:01"}, sent, time.Date(2023, 1, 5, 18, 30, 1, 0, time.Local)},
+		{"slash minutes", XmlRecordMessageDataItem{SourceTime: "2023/12/25 7:05"}, sent, time.Date(2023, 12, 25, 7, 5, 0, 0, time.Local)},
+		{"without year", XmlRecordMessageDataItem{SourceTime: "3/8 09:15"}, sent, time.Date(2023, 3, 8, 9, 15, 0, 0, time.Local)},
+		{"without year after sent is last year", XmlRecordMessageDataItem{SourceTime: "12/31 23:00"}, time.Date(2024, 1, 5, 8, 0, 0, 0, time.Local), time.Date(2023, 12, 31, 23, 0, 0, 0, time.Local)},
+		{"without year sent unknown", XmlRecordMessageDataItem{SourceTime: "3/8 09:15"}, time.Time{}, time.Time{}},
+		{"surrounding space", XmlRecordMessageDataItem{SourceTime: "  2023-11-15 08:09:10\n"}, sent, time.Date(2023, 11, 15, 8, 9, 10, 0, time.Local)},
+		{"empty", XmlRecordMessageDataItem{}, sent, time.Time{}},
+		{"garbage", XmlRecordMessageDataItem{SourceTime: "yesterday"}, sent, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseSourceTime(&tt.item, tt.sent); !got.Equal(tt.want) {
+				t.Errorf("parseSourceTime(%q) = %v, want %v", tt.item.SourceTime, got, tt.want)
+			}
+		})
+	}
+}
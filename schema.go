@@ -0,0 +1,396 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/urfave/cli/v2"
+	"os"
+	"strings"
+)
+
+var SchemaCommand = &cli.Command{
+	Name:   "schema",
+	Usage:  "print detected Backup.db schema and version",
+	Action: actionSchema,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "db",
+			Usage:   "decrypted Backup.db file path",
+			Value:   "Backup.db",
+			Aliases: []string{"d"},
+		},
+		&cli.StringFlag{
+			Name:    "format",
+			Usage:   "output format table or json",
+			Value:   "table",
+			Aliases: []string{"f"},
+		},
+	},
+}
+
+// column struct field bound to table column by name, columns() keep original table order
+// for positional guess
+type column struct {
+	Name string
+	// Aliases other names seen for same column
+	Aliases  []string
+	Dest     interface{}
+	Required bool
+}
+
+func (s *Session) columns() []column {
+	return []column{
+		{Name: "Talker", Dest: &s.Talker},
+		{Name: "EndTime", Dest: &s.EndTime},
+		{Name: "TotalSize", Dest: &s.TotalSize},
+		{Name: "NickName", Dest: &s.NickName},
+		{Name: "Reserved0", Dest: &s.Reserved0},
+		{Name: "Reserved1", Dest: &s.Reserved1},
+		{Name: "Reserved2", Dest: &s.Reserved2},
+		{Name: "Reserved3", Dest: &s.Reserved3},
+		{Name: "StartTime", Aliases: []string{"Reserved4"}, Dest: &s.StartTime},
+		{Name: "Reserved5", Dest: &s.Reserved5},
+	}
+}
+
+func (n *Name2ID) columns() []column {
+	return []column{
+		{Name: "UsrName", Dest: &n.UsrName},
+	}
+}
+
+func (m *MsgSegment) columns() []column {
+	return []column{
+		{Name: "TalkerId", Dest: &m.TalkerId, Required: true},
+		{Name: "StartTime", Dest: &m.StartTime},
+		{Name: "EndTime", Dest: &m.EndTime},
+		{Name: "OffSet", Dest: &m.OffSet},
+		{Name: "Length", Dest: &m.Length},
+		{Name: "UsrName", Dest: &m.UsrName},
+		{Name: "Status", Aliases: []string{"Reserved0"}, Dest: &m.Status},
+		{Name: "Reserved1", Dest: &m.Reserved1},
+		{Name: "FilePath", Dest: &m.FilePath},
+		{Name: "SegmentId", Dest: &m.SegmentId},
+		{Name: "Reserved2", Dest: &m.Reserved2},
+		{Name: "Reserved3", Dest: &m.Reserved3},
+	}
+}
+
+func (f *MsgFileSegment) columns() []column {
+	return []column{
+		{Name: "MapKey", Dest: &f.MapKey, Required: true},
+		{Name: "InnerOffSet", Dest: &f.InnerOffSet, Required: true},
+		{Name: "Length", Dest: &f.Length},
+		{Name: "TotalLen", Dest: &f.TotalLen},
+		{Name: "OffSet", Dest: &f.OffSet},
+		{Name: "Reserved1", Dest: &f.Reserved1},
+		{Name: "FileName", Dest: &f.FileName},
+		{Name: "Reserved2", Dest: &f.Reserved2},
+		{Name: "Reserved3", Dest: &f.Reserved3},
+		{Name: "Reserved4", Dest: &f.Reserved4},
+	}
+}
+
+func (m *MsgMedia) columns() []column {
+	return []column{
+		{Name: "TalkerId", Dest: &m.TalkerId},
+		{Name: "MediaId", Dest: &m.MediaId},
+		{Name: "MsgSegmentId", Dest: &m.MsgSegmentId},
+		{Name: "SrvId", Dest: &m.SrvId},
+		{Name: "MD5", Dest: &m.MD5},
+		{Name: "Talker", Dest: &m.Talker},
+		{Name: "MediaIdStr", Dest: &m.MediaIdStr, Required: true},
+		{Name: "Reserved0", Dest: &m.Reserved0},
+		{Name: "Reserved1", Dest: &m.Reserved1},
+		{Name: "Reserved2", Dest: &m.Reserved2},
+	}
+}
+
+func (c *Config) columns() []column {
+	return []column{
+		{Name: "Key", Dest: &c.Key},
+		{Name: "Reserved0", Dest: &c.Reserved0},
+		{Name: "Buf", Dest: &c.Buf},
+		{Name: "Reserved1", Dest: &c.Reserved1},
+		{Name: "Reserved2", Dest: &c.Reserved2},
+	}
+}
+
+// knownTables columns wcdb understand of every table
+var knownTables = []struct {
+	Name    string
+	Columns func() []column
+}{
+	{"Session", func() []column { return (&Session{}).columns() }},
+	{"Name2ID", func() []column { return (&Name2ID{}).columns() }},
+	{"MsgSegments", func() []column { return (&MsgSegment{}).columns() }},
+	{"MsgFileSegment", func() []column { return (&MsgFileSegment{}).columns() }},
+	{"MsgMedia", func() []column { return (&MsgMedia{}).columns() }},
+	{"Config", func() []column { return (&Config{}).columns() }},
+}
+
+type ColumnInfo struct {
+	Name string
+	Type string
+	// Field known column name, empty for extra column
+	Field string
+}
+
+// ColumnGuess extra column which may be renamed known Field
+type ColumnGuess struct {
+	Column string
+	Field  string
+}
+
+type TableSchema struct {
+	Name    string
+	Known   bool
+	Exists  bool
+	Columns []ColumnInfo
+	// Missing known columns not in table
+	Missing []string
+	// Guesses unmatched column at position of missing known column, reported only never read
+	Guesses []ColumnGuess
+	// mapping known column name to actual column
+	mapping map[string]string
+}
+
+type Schema struct {
+	// Version sqlite user_version pragma
+	Version int
+	Tables  []*TableSchema
+	tables  map[string]*TableSchema
+}
+
+func tableColumns(db *sql.DB, table string) ([]ColumnInfo, error) {
+	rows, err := db.Query("SELECT name, type FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []ColumnInfo
+	for rows.Next() {
+		var c ColumnInfo
+		if err = rows.Scan(&c.Name, &c.Type); err != nil {
+			return nil, err
+		}
+		columns = append(columns, c)
+	}
+	return columns, rows.Err()
+}
+
+// probeSchema map known columns by name case insensitive, extra and missing column is tolerated
+func probeSchema(db *sql.DB) (*Schema, error) {
+	schema := &Schema{tables: make(map[string]*TableSchema)}
+	if err := db.QueryRow("PRAGMA user_version").Scan(&schema.Version); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(knownTables); i++ {
+		t := &TableSchema{Name: knownTables[i].Name, Known: true, mapping: make(map[string]string)}
+		var err error
+		if t.Columns, err = tableColumns(db, t.Name); err != nil {
+			return nil, err
+		}
+		t.Exists = len(t.Columns) > 0
+
+		known := knownTables[i].Columns()
+		for j := 0; j < len(known); j++ {
+			names := append([]string{known[j].Name}, known[j].Aliases...)
+			found := false
+			for k := 0; k < len(names) && !found; k++ {
+				for c := 0; c < len(t.Columns); c++ {
+					if t.Columns[c].Field == "" && strings.EqualFold(t.Columns[c].Name, names[k]) {
+						t.Columns[c].Field = known[j].Name
+						t.mapping[known[j].Name] = t.Columns[c].Name
+						found = true
+						break
+					}
+				}
+			}
+			if !found {
+				t.Missing = append(t.Missing, known[j].Name)
+			}
+		}
+
+		// renamed column of original layout may line up by position, too weak to bind
+		if len(t.Missing) > 0 && len(t.Columns) == len(known) {
+			for j := 0; j < len(known); j++ {
+				if _, ok := t.mapping[known[j].Name]; !ok && t.Columns[j].Field == "" {
+					t.Guesses = append(t.Guesses, ColumnGuess{Column: t.Columns[j].Name, Field: known[j].Name})
+				}
+			}
+		}
+		schema.Tables = append(schema.Tables, t)
+		schema.tables[t.Name] = t
+	}
+
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var others []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		if _, ok := schema.tables[name]; !ok {
+			others = append(others, name)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(others); i++ {
+		t := &TableSchema{Name: others[i], Exists: true}
+		if t.Columns, err = tableColumns(db, t.Name); err != nil {
+			return nil, err
+		}
+		schema.Tables = append(schema.Tables, t)
+	}
+	return schema, nil
+}
+
+func (s *Schema) HasTable(table string) bool {
+	t, ok := s.tables[table]
+	return ok && t.Exists
+}
+
+// HasColumn known column found in table
+func (s *Schema) HasColumn(table, column string) bool {
+	t, ok := s.tables[table]
+	if !ok {
+		return false
+	}
+	_, ok = t.mapping[column]
+	return ok
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// columnNames quoted actual names of known columns for raw query, error when table lack any
+func (s *Schema) columnNames(table string, columns ...string) ([]string, error) {
+	t, ok := s.tables[table]
+	if !ok || !t.Exists {
+		return nil, fmt.Errorf("table %s missing from Backup.db", table)
+	}
+	names := make([]string, 0, len(columns))
+	for i := 0; i < len(columns); i++ {
+		name, ok := t.mapping[columns[i]]
+		if !ok {
+			return nil, fmt.Errorf("column %s.%s missing from Backup.db", table, columns[i])
+		}
+		names = append(names, quoteIdent(name))
+	}
+	return names, nil
+}
+
+// columnOr quoted actual name of known column, fallback expression when table lack it
+func (s *Schema) columnOr(table, column, fallback string) string {
+	if t, ok := s.tables[table]; ok {
+		if name, ok := t.mapping[column]; ok {
+			return quoteIdent(name)
+		}
+	}
+	return fallback
+}
+
+// selectColumns explicit column list and scan destination of known columns present in table
+func (s *Schema) selectColumns(table string, columns []column) (string, []interface{}, error) {
+	t, ok := s.tables[table]
+	if !ok || !t.Exists {
+		return "", nil, fmt.Errorf("table %s missing from Backup.db", table)
+	}
+	names := make([]string, 0, len(columns))
+	dest := make([]interface{}, 0, len(columns))
+	for i := 0; i < len(columns); i++ {
+		name, ok := t.mapping[columns[i].Name]
+		if !ok {
+			if columns[i].Required {
+				return "", nil, fmt.Errorf("column %s.%s missing from Backup.db", table, columns[i].Name)
+			}
+			continue
+		}
+		names = append(names, quoteIdent(name))
+		dest = append(dest, columns[i].Dest)
+	}
+	if len(names) == 0 {
+		return "", nil, fmt.Errorf("no usable columns in %s", table)
+	}
+	return strings.Join(names, ", "), dest, nil
+}
+
+func actionSchema(ctx *cli.Context) error {
+	dbName := ctx.String("db")
+	format := ctx.String("format")
+	switch format {
+	case "table", "json":
+	default:
+		return errors.New("unsupported format " + format)
+	}
+
+	db, err := NewBackupDB(dbName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	schema := db.Schema()
+	if format == "json" {
+		return writeJSON(os.Stdout, schema)
+	}
+
+	version := ""
+	if db.Schema().HasTable("Config") {
+		entries, err := db.Config()
+		if err != nil {
+			return err
+		}
+		if e := configValue(entries, "version"); e != nil {
+			version = e.Value
+		}
+	}
+	fmt.Printf("user_version: %d\n", schema.Version)
+	if version != "" {
+		fmt.Printf("backup version: %s\n", version)
+	}
+
+	var rows [][]string
+	for i := 0; i < len(schema.Tables); i++ {
+		t := schema.Tables[i]
+		switch {
+		case !t.Exists:
+			rows = append(rows, []string{t.Name, "", "", "table missing"})
+			continue
+		case !t.Known:
+			rows = append(rows, []string{t.Name, "", "", "unknown table"})
+		}
+		for j := 0; j < len(t.Columns); j++ {
+			c := t.Columns[j]
+			status := "known"
+			if !t.Known {
+				status = ""
+			} else if c.Field == "" {
+				status = "extra"
+			} else if !strings.EqualFold(c.Field, c.Name) {
+				status = "known as " + c.Field
+			}
+			for k := 0; k < len(t.Guesses); k++ {
+				if t.Guesses[k].Column == c.Name {
+					status += ", maybe " + t.Guesses[k].Field
+				}
+			}
+			rows = append(rows, []string{t.Name, c.Name, c.Type, status})
+		}
+		for j := 0; j < len(t.Missing); j++ {
+			rows = append(rows, []string{t.Name, t.Missing[j], "", "missing"})
+		}
+	}
+	fmt.Println(newRowsTable([]string{"Table", "Column", "Type", "Status"}, rows).Render())
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestProbeSchemaGuesses(t *testing.T) {
+	tests := []struct {
+		name     string
+		create   string
+		guesses  []ColumnGuess
+		missing  []string
+		talkerId string
+	}{
+		{"original", "CREATE TABLE MsgSegments (TalkerId, StartTime, EndTime, OffSet, Length, UsrName, Status, Reserved1, FilePath, SegmentId, Reserved2, Reserved3)", nil, nil, "TalkerId"},
+		{"alias", "CREATE TABLE MsgSegments (talkerid, StartTime, EndTime, OffSet, Length, UsrName, Reserved0, Reserved1, FilePath, SegmentId, Reserved2, Reserved3)", nil, nil, "talkerid"},
+		{"renamed same layout", "CREATE TABLE MsgSegments (tid, StartTime, EndTime, OffSet, len, UsrName, Status, Reserved1, FilePath, SegmentId, Reserved2, Reserved3)",
+			[]ColumnGuess{{"tid", "TalkerId"}, {"len", "Length"}}, []string{"TalkerId", "Length"}, ""},
+		{"reordered same width", "CREATE TABLE MsgSegments (StartTime, tid, EndTime, OffSet, Length, UsrName, Status, Reserved1, FilePath, SegmentId, Reserved2, Reserved3)",
+			nil, []string{"TalkerId"}, ""},
+		{"renamed other layout", "CREATE TABLE MsgSegments (tid, StartTime, EndTime, OffSet, Length, UsrName, FilePath)",
+			nil, []string{"TalkerId", "Status", "Reserved1", "SegmentId", "Reserved2", "Reserved3"}, ""},
+		{"moved column", "CREATE TABLE MsgSegments (StartTime, TalkerId, EndTime, OffSet, Length, UsrName, Status, Reserved1, FilePath, SegmentId, Reserved2, x)",
+			[]ColumnGuess{{"x", "Reserved3"}}, []string{"Reserved3"}, "TalkerId"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := sql.Open("sqlite3", ":memory:")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if _, err = db.Exec(tt.create); err != nil {
+				t.Fatal(err)
+			}
+			schema, err := probeSchema(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			table := schema.tables["MsgSegments"]
+			if !reflect.DeepEqual(table.Guesses, tt.guesses) {
+				t.Errorf("Guesses = %v, want %v", table.Guesses, tt.guesses)
+			}
+			if !reflect.DeepEqual(table.Missing, tt.missing) {
+				t.Errorf("Missing = %q, want %q", table.Missing, tt.missing)
+			}
+			if got := table.mapping["TalkerId"]; got != tt.talkerId {
+				t.Errorf("TalkerId mapped to %q, want %q", got, tt.talkerId)
+			}
+			_, err = schema.columnNames("MsgSegments", "TalkerId")
+			if (err == nil) != (tt.talkerId != "") {
+				t.Errorf("columnNames error %v, want mapped %v", err, tt.talkerId != "")
+			}
+		})
+	}
+}
+
+func TestSelectColumnsNoUsable(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err = db.Exec("CREATE TABLE Config (k, r0, b, r1, r2, extra)"); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := probeSchema(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c Config
+	if _, _, err = schema.selectColumns("Config", c.columns()); err == nil || err.Error() != "no usable columns in Config" {
+		t.Errorf("selectColumns error %v, want no usable columns", err)
+	}
+	b := &BackupDB{db: db, schema: schema}
+	if entries, err := b.Config(); err != nil || entries != nil {
+		t.Errorf("Config() = %v, %v, want skipped", entries, err)
+	}
+}
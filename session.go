@@ -1,11 +1,17 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"github.com/anonymous5l/wcdb/protobuf"
 	"github.com/dustin/go-humanize"
 	"github.com/jedib0t/go-pretty/v6/table"
-	"github.com/jedib0t/go-pretty/v6/text"
 	"github.com/urfave/cli/v2"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var SessionCommand = &cli.Command{
@@ -24,12 +30,141 @@ var SessionCommand = &cli.Command{
 			Usage:   "nickname string length limit default 0 no limit",
 			Aliases: []string{"l"},
 		},
+		&cli.StringFlag{
+			Name:    "resource",
+			Usage:   "BAK_0_XXX folder path, count messages when given",
+			Aliases: []string{"r"},
+		},
+		&cli.StringFlag{
+			Name:    "pass",
+			Usage:   "decrypt media resource file chunk key",
+			Aliases: []string{"p"},
+		},
+		&cli.StringFlag{
+			Name:  "type",
+			Usage: "only list private, group or official session",
+		},
+		&cli.StringFlag{
+			Name:  "since",
+			Usage: "only list session active since date, eg 2023-01-02",
+		},
+		&cli.StringFlag{
+			Name:    "match",
+			Usage:   "only list session talker or nickname contain text",
+			Aliases: []string{"m"},
+		},
+		&cli.StringFlag{
+			Name:    "sort",
+			Usage:   "sort by size, media, messages, start, end, name or talker",
+			Value:   "size",
+			Aliases: []string{"s"},
+		},
+		&cli.BoolFlag{
+			Name:  "reverse",
+			Usage: "reverse sort order",
+		},
+		&cli.StringFlag{
+			Name:    "format",
+			Usage:   "output format table, json, csv or markdown",
+			Value:   "table",
+			Aliases: []string{"f"},
+		},
 	},
 }
 
+// chatKind private, group or official account
+func chatKind(talker string) string {
+	switch {
+	case isChatroom(talker):
+		return "group"
+	case strings.HasPrefix(talker, "gh_"):
+		return "official"
+	}
+	return "private"
+}
+
+type SessionInfo struct {
+	Talker    string
+	NickName  string
+	Kind      string
+	Start     time.Time
+	End       time.Time
+	TotalSize int64
+	// Messages -1 when resource not given
+	Messages   int
+	MediaBytes int64
+}
+
+func countMessages(db *BackupDB, resource string, pass Pass, talker string) (int, error) {
+	talkerId, err := db.TalkerId(talker)
+	if err == ErrNoTalker {
+		// session without any message
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	count := 0
+	err = walkMessages(db, resource, pass, talkerId, func(*protobuf.BakChatMsgItem) error {
+		count++
+		return nil
+	})
+	return count, err
+}
+
+var sessionSorts = map[string]func(a, b *SessionInfo) bool{
+	"size":     func(a, b *SessionInfo) bool { return a.TotalSize > b.TotalSize },
+	"media":    func(a, b *SessionInfo) bool { return a.MediaBytes > b.MediaBytes },
+	"messages": func(a, b *SessionInfo) bool { return a.Messages > b.Messages },
+	"start":    func(a, b *SessionInfo) bool { return a.Start.Before(b.Start) },
+	"end":      func(a, b *SessionInfo) bool { return a.End.After(b.End) },
+	"name":     func(a, b *SessionInfo) bool { return a.NickName < b.NickName },
+	"talker":   func(a, b *SessionInfo) bool { return a.Talker < b.Talker },
+}
+
+func sessionTime(ts int64) time.Time {
+	if ts <= 0 {
+		return time.Time{}
+	}
+	return unixTime(ts)
+}
+
 func actionSession(ctx *cli.Context) error {
 	dbName := ctx.String("db")
 	limit := ctx.Int("limit")
+	resource := ctx.String("resource")
+	pass := Pass(ctx.String("pass"))
+	kind := ctx.String("type")
+	match := strings.ToLower(ctx.String("match"))
+	sortKey := ctx.String("sort")
+	reverse := ctx.Bool("reverse")
+	format := ctx.String("format")
+
+	less, ok := sessionSorts[sortKey]
+	if !ok {
+		return errors.New("unsupported sort key " + sortKey)
+	}
+	switch format {
+	case "table", "json", "csv", "markdown":
+	default:
+		return errors.New("unsupported format " + format)
+	}
+	switch kind {
+	case "", "private", "group", "official":
+	default:
+		return errors.New("unsupported session type " + kind)
+	}
+	var since time.Time
+	if value := ctx.String("since"); value != "" {
+		var err error
+		if since, err = parseDate(value); err != nil {
+			return err
+		}
+	}
+	if resource != "" && !pass.Valid() {
+		return ErrInvalidPassKey
+	}
+
+	defer releaseFds()
 
 	db, err := NewBackupDB(dbName)
 	if err != nil {
@@ -42,34 +177,103 @@ func actionSession(ctx *cli.Context) error {
 		return err
 	}
 
-	style := table.StyleDefault
-	style.Name = "CustomTable"
-	style.Format.Header = text.FormatDefault
-	style.Format.Footer = text.FormatDefault
-
-	t := table.NewWriter()
-	t.SetStyle(style)
-	t.AppendHeader(table.Row{"Talker", "NickName", "TotalSize"})
+	mediaSizes, err := db.TalkerMediaSizes()
+	if err != nil {
+		return err
+	}
 
-	totalSize := int64(0)
+	var infos []*SessionInfo
 	for i := 0; i < len(sessions); i++ {
 		s := sessions[i]
+		info := &SessionInfo{
+			Talker:     s.Talker,
+			NickName:   s.NickName,
+			Kind:       chatKind(s.Talker),
+			Start:      sessionTime(s.StartTime),
+			End:        sessionTime(s.EndTime),
+			TotalSize:  s.TotalSize,
+			Messages:   -1,
+			MediaBytes: mediaSizes[s.Talker],
+		}
+		if kind != "" && info.Kind != kind {
+			continue
+		}
+		if !since.IsZero() && info.End.Before(since) {
+			continue
+		}
+		if match != "" && !strings.Contains(strings.ToLower(info.NickName), match) &&
+			!strings.Contains(strings.ToLower(info.Talker), match) {
+			continue
+		}
+		if resource != "" {
+			if info.Messages, err = countMessages(db, resource, pass, s.Talker); err != nil {
+				return err
+			}
+		}
+		infos = append(infos, info)
+	}
+
+	sort.SliceStable(infos, func(i, j int) bool {
+		if reverse {
+			return less(infos[j], infos[i])
+		}
+		return less(infos[i], infos[j])
+	})
+
+	if format == "json" {
+		return writeJSON(os.Stdout, infos)
+	}
+
+	header := []string{"Talker", "NickName", "Kind", "Start", "End", "Messages", "Media", "TotalSize"}
+	rows := make([][]string, 0, len(infos)+1)
+	totalSize, totalMedia, totalMessages := int64(0), int64(0), 0
+	for i := 0; i < len(infos); i++ {
+		s := infos[i]
 		nickname := []rune(s.NickName)
 		if limit > 0 && len(nickname) > limit {
 			nickname = append(nickname[:limit], []rune("...")...)
 		}
-		t.AppendRow(table.Row{
+		messages := ""
+		if s.Messages >= 0 {
+			messages = strconv.Itoa(s.Messages)
+			totalMessages += s.Messages
+		}
+		media, size := humanize.Bytes(uint64(s.MediaBytes)), humanize.Bytes(uint64(s.TotalSize))
+		if format == "csv" {
+			media, size = strconv.FormatInt(s.MediaBytes, 10), strconv.FormatInt(s.TotalSize, 10)
+		}
+		rows = append(rows, []string{
 			s.Talker,
 			string(nickname),
-			humanize.Bytes(uint64(s.TotalSize)),
+			s.Kind,
+			formatDate(s.Start),
+			formatDate(s.End),
+			messages,
+			media,
+			size,
 		})
 		totalSize += s.TotalSize
+		totalMedia += s.MediaBytes
 	}
 
+	if format == "csv" {
+		return writeCSV(os.Stdout, header, rows)
+	}
+
+	messages := ""
+	if resource != "" {
+		messages = strconv.Itoa(totalMessages)
+	}
+	t := newRowsTable(header, rows)
 	t.AppendSeparator()
-	t.AppendFooter(table.Row{"", "Total", humanize.Bytes(uint64(totalSize))})
+	t.AppendFooter(table.Row{"", "Total", "", "", "", messages,
+		humanize.Bytes(uint64(totalMedia)), humanize.Bytes(uint64(totalSize))})
 
-	fmt.Println(t.Render())
+	if format == "markdown" {
+		fmt.Println(t.RenderMarkdown())
+	} else {
+		fmt.Println(t.Render())
+	}
 
 	return nil
 }
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/h2non/filetype"
+	"strings"
+)
+
+type FileType struct {
+	Extension string
+	MIME      string
+}
+
+var (
+	FileTypeUnknown = FileType{}
+	FileTypeSilk    = FileType{Extension: "aud", MIME: "audio/silk"}
+	FileTypeWxgf    = FileType{Extension: "wxgf", MIME: "image/x-wechat-wxgf"}
+	FileTypeHevc    = FileType{Extension: "hevc", MIME: "video/hevc"}
+	FileTypeHeic    = FileType{Extension: "heic", MIME: "image/heic"}
+	FileTypeDat     = FileType{Extension: "dat", MIME: "application/x-wechat-dat"}
+	FileTypeDoc     = FileType{Extension: "doc", MIME: "application/msword"}
+	FileTypeXls     = FileType{Extension: "xls", MIME: "application/vnd.ms-excel"}
+	FileTypePpt     = FileType{Extension: "ppt", MIME: "application/vnd.ms-powerpoint"}
+	FileTypeDocx    = FileType{Extension: "docx", MIME: "application/vnd.openxmlformats-officedocument.wordprocessingml.document"}
+	FileTypeXlsx    = FileType{Extension: "xlsx", MIME: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"}
+	FileTypePptx    = FileType{Extension: "pptx", MIME: "application/vnd.openxmlformats-officedocument.presentationml.presentation"}
+	FileTypeEpub    = FileType{Extension: "epub", MIME: "application/epub+zip"}
+	FileTypeApk     = FileType{Extension: "apk", MIME: "application/vnd.android.package-archive"}
+	FileTypeJar     = FileType{Extension: "jar", MIME: "application/java-archive"}
+	FileTypeZip     = FileType{Extension: "zip", MIME: "application/zip"}
+)
+
+var (
+	silkHead = []byte{0x02, 0x23, 0x21, 0x53, 0x49, 0x4C, 0x4B, 0x5F, 0x56, 0x33}
+	wxgfHead = []byte("wxgf")
+	// annex-b start code follow VPS nal unit
+	hevcHead = []byte{0x00, 0x00, 0x00, 0x01, 0x40, 0x01}
+	cfbHead  = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+	zipHead  = []byte{0x50, 0x4B, 0x03, 0x04}
+)
+
+// hasAt bounds safe compare of buf[off:] prefix
+func hasAt(buf []byte, off int, sig []byte) bool {
+	if off < 0 || len(buf) < off+len(sig) {
+		return false
+	}
+	return bytes.Equal(buf[off:off+len(sig)], sig)
+}
+
+func byteAt(buf []byte, off int) (byte, bool) {
+	if off < 0 || off >= len(buf) {
+		return 0, false
+	}
+	return buf[off], true
+}
+
+type sniffer func(buf []byte) (FileType, bool)
+
+// order matters, more specific matcher first
+var sniffers = []sniffer{
+	sniffSilk,
+	sniffWxgf,
+	sniffHevc,
+	sniffHeic,
+	sniffCfb,
+	sniffZip,
+}
+
+func sniffSilk(buf []byte) (FileType, bool) {
+	// some silk file without leading 0x02
+	return FileTypeSilk, hasAt(buf, 0, silkHead) || hasAt(buf, 0, silkHead[1:])
+}
+
+func sniffWxgf(buf []byte) (FileType, bool) {
+	return FileTypeWxgf, hasAt(buf, 0, wxgfHead)
+}
+
+func sniffHevc(buf []byte) (FileType, bool) {
+	return FileTypeHevc, hasAt(buf, 0, hevcHead)
+}
+
+func sniffHeic(buf []byte) (FileType, bool) {
+	if !hasAt(buf, 4, []byte("ftyp")) {
+		return FileTypeUnknown, false
+	}
+	boxSize := int(binary.BigEndian.Uint32(buf[:4]))
+	if boxSize < 16 || boxSize > len(buf) {
+		boxSize = len(buf)
+	}
+	// major brand then minor version then compatible brands
+	for off := 8; off+4 <= boxSize; off += 4 {
+		if off == 12 {
+			continue
+		}
+		switch string(buf[off : off+4]) {
+		case "heic", "heix", "hevc", "hevx", "heim", "heis":
+			return FileTypeHeic, true
+		}
+	}
+	return FileTypeUnknown, false
+}
+
+func sniffCfb(buf []byte) (FileType, bool) {
+	if !hasAt(buf, 0, cfbHead) {
+		return FileTypeUnknown, false
+	}
+
+	// same order as former filetype matchers, doc, xls then ppt
+	switch {
+	case hasAt(buf, 512, []byte{0xEC, 0xA5, 0xC1, 0x00}):
+		return FileTypeDoc, true
+	case hasAt(buf, 512, []byte{0xFD, 0xFF, 0xFF, 0xFF}):
+		b516, ok516 := byteAt(buf, 516)
+		if ok516 && (b516 == 0 || b516 == 2) {
+			return FileTypeXls, true
+		}
+		b517, ok517 := byteAt(buf, 517)
+		b518, ok518 := byteAt(buf, 518)
+		if ok517 && ok518 && b517 == 0 && b518 == 0 {
+			return FileTypePpt, true
+		}
+	case hasAt(buf, 512, []byte{0x09, 0x08, 0x10, 0x00, 0x00, 0x06, 0x05, 0x00}):
+		return FileTypeXls, true
+	case hasAt(buf, 512, []byte{0xA0, 0x46, 0x1D, 0xF0}),
+		hasAt(buf, 512, []byte{0x00, 0x6E, 0x1E, 0xF0}),
+		hasAt(buf, 512, []byte{0x0F, 0x00, 0xE8, 0x03}):
+		return FileTypePpt, true
+	}
+
+	return FileTypeUnknown, false
+}
+
+// zipEntries walk zip local file headers collect entry names,
+// stop at first entry without known compressed size
+func zipEntries(buf []byte, limit int) []string {
+	var names []string
+	off := 0
+	for len(names) < limit && hasAt(buf, off, zipHead) && off+30 <= len(buf) {
+		flag := binary.LittleEndian.Uint16(buf[off+6:])
+		compressed := int(binary.LittleEndian.Uint32(buf[off+18:]))
+		nameLen := int(binary.LittleEndian.Uint16(buf[off+26:]))
+		extraLen := int(binary.LittleEndian.Uint16(buf[off+28:]))
+		if off+30+nameLen > len(buf) {
+			break
+		}
+		names = append(names, string(buf[off+30:off+30+nameLen]))
+		if flag&0x08 != 0 {
+			break
+		}
+		off += 30 + nameLen + extraLen + compressed
+	}
+	return names
+}
+
+func sniffZip(buf []byte) (FileType, bool) {
+	if !hasAt(buf, 0, zipHead) {
+		return FileTypeUnknown, false
+	}
+
+	// epub require uncompressed mimetype as first entry
+	if hasAt(buf, 30, []byte("mimetypeapplication/epub+zip")) {
+		return FileTypeEpub, true
+	}
+
+	names := zipEntries(buf, 64)
+	for i := 0; i < len(names); i++ {
+		name := names[i]
+		switch {
+		case strings.HasPrefix(name, "word/"):
+			return FileTypeDocx, true
+		case strings.HasPrefix(name, "xl/"):
+			return FileTypeXlsx, true
+		case strings.HasPrefix(name, "ppt/"):
+			return FileTypePptx, true
+		case name == "AndroidManifest.xml", name == "classes.dex":
+			return FileTypeApk, true
+		}
+	}
+
+	// entry list incomplete, search central directory names instead
+	switch {
+	case bytes.Contains(buf, []byte("word/document.xml")):
+		return FileTypeDocx, true
+	case bytes.Contains(buf, []byte("xl/workbook.xml")):
+		return FileTypeXlsx, true
+	case bytes.Contains(buf, []byte("ppt/presentation.xml")):
+		return FileTypePptx, true
+	case bytes.Contains(buf, []byte("AndroidManifest.xml")):
+		return FileTypeApk, true
+	}
+
+	for i := 0; i < len(names); i++ {
+		if names[i] == "META-INF/MANIFEST.MF" {
+			return FileTypeJar, true
+		}
+	}
+
+	return FileTypeZip, true
+}
+
+var datHeads = [][]byte{
+	{0xFF, 0xD8, 0xFF},       // jpeg
+	{0x89, 0x50, 0x4E, 0x47}, // png
+	{0x47, 0x49, 0x46, 0x38}, // gif
+	{0x49, 0x49, 0x2A, 0x00}, // tiff
+	{0x52, 0x49, 0x46, 0x46}, // webp
+}
+
+// DatKey detect wechat .dat image single byte xor key
+func DatKey(buf []byte) (byte, bool) {
+	if len(buf) == 0 {
+		return 0, false
+	}
+	for i := 0; i < len(datHeads); i++ {
+		head := datHeads[i]
+		if len(buf) < len(head) {
+			continue
+		}
+		key := buf[0] ^ head[0]
+		// zero key means plain image
+		if key == 0 {
+			continue
+		}
+		match := true
+		for j := 1; j < len(head); j++ {
+			if buf[j]^key != head[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return key, true
+		}
+	}
+	return 0, false
+}
+
+func sniffDat(buf []byte) (FileType, bool) {
+	_, ok := DatKey(buf)
+	return FileTypeDat, ok
+}
+
+func Sniff(buf []byte) FileType {
+	if len(buf) == 0 {
+		return FileTypeUnknown
+	}
+
+	for i := 0; i < len(sniffers); i++ {
+		if t, ok := sniffers[i](buf); ok {
+			return t
+		}
+	}
+
+	t, err := filetype.Match(buf)
+	if err == nil && t != filetype.Unknown {
+		return FileType{Extension: t.Extension, MIME: t.MIME.Value}
+	}
+
+	// plain format known by filetype always win over xor guess
+	if t, ok := sniffDat(buf); ok {
+		return t
+	}
+
+	return FileTypeUnknown
+}
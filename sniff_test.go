@@ -0,0 +1,196 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+// cfbFile compound file header with marker at offset 512, padded to size
+func cfbFile(marker []byte, size int) []byte {
+	buf := make([]byte, size)
+	copy(buf, cfbHead)
+	if len(marker) > 0 && size > 512 {
+		copy(buf[512:], marker)
+	}
+	return buf
+}
+
+type zipEntry struct {
+	name string
+	data string
+}
+
+// zipFile stored entries, raw mode keep sizes in local header like office writer
+func zipFile(t *testing.T, entries ...zipEntry) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, e := range entries {
+		h := &zip.FileHeader{
+			Name:               e.name,
+			Method:             zip.Store,
+			CRC32:              crc32.ChecksumIEEE([]byte(e.data)),
+			CompressedSize64:   uint64(len(e.data)),
+			UncompressedSize64: uint64(len(e.data)),
+		}
+		f, err := w.CreateRaw(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = f.Write([]byte(e.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// streamZipFile deflated entries with data descriptor, sizes unknown in local header
+func streamZipFile(t *testing.T, names ...string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range names {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = f.Write([]byte("<xml/>")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func ftyp(brands ...string) []byte {
+	buf := make([]byte, 8, 8+4*len(brands)+4)
+	copy(buf[4:], "ftyp")
+	for i, brand := range brands {
+		buf = append(buf, brand...)
+		// minor version after major brand
+		if i == 0 {
+			buf = append(buf, 0, 0, 0, 0)
+		}
+	}
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)))
+	return append(buf, make([]byte, 16)...)
+}
+
+func xorBytes(buf []byte, key byte) []byte {
+	out := make([]byte, len(buf))
+	for i := range buf {
+		out[i] = buf[i] ^ key
+	}
+	return out
+}
+
+func TestSniff(t *testing.T) {
+	jpeg := append([]byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0x00}, make([]byte, 32)...)
+	png := append([]byte{0x89, 'P', 'N', 'G', 0x0D, 0x0A, 0x1A, 0x0A}, make([]byte, 32)...)
+
+	tests := []struct {
+		name string
+		buf  []byte
+		want FileType
+	}{
+		{"empty", nil, FileTypeUnknown},
+		{"silk", append(append([]byte{}, silkHead...), 0x0C, 0x00), FileTypeSilk},
+		{"silk without 0x02", []byte("#!SILK_V3\x0C\x00"), FileTypeSilk},
+		{"silk truncated", silkHead[:5], FileTypeUnknown},
+		{"wxgf", []byte("wxgf\x01\x02\x03"), FileTypeWxgf},
+		{"hevc", append(append([]byte{}, hevcHead...), 0x0C, 0x01), FileTypeHevc},
+		{"heic major brand", ftyp("heic", "mif1"), FileTypeHeic},
+		{"heix major brand", ftyp("heix", "mif1"), FileTypeHeic},
+		{"heic compatible brand", ftyp("mif1", "mif1", "heic"), FileTypeHeic},
+		{"ftyp short", []byte("\x00\x00\x00\x18ftyp"), FileTypeUnknown},
+		{"doc", cfbFile([]byte{0xEC, 0xA5, 0xC1, 0x00}, 1024), FileTypeDoc},
+		{"xls", cfbFile([]byte{0x09, 0x08, 0x10, 0x00, 0x00, 0x06, 0x05, 0x00}, 1024), FileTypeXls},
+		{"ppt", cfbFile([]byte{0xA0, 0x46, 0x1D, 0xF0}, 1024), FileTypePpt},
+		{"ppt by 0xfd 517", cfbFile([]byte{0xFD, 0xFF, 0xFF, 0xFF, 0x0E, 0x00, 0x00}, 1024), FileTypePpt},
+		{"xls by 0xfd 516", cfbFile([]byte{0xFD, 0xFF, 0xFF, 0xFF, 0x02, 0x01, 0x00}, 1024), FileTypeXls},
+		{"xls before ppt by 0xfd", cfbFile([]byte{0xFD, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0x00}, 1024), FileTypeXls},
+		{"docx", zipFile(t, zipEntry{"[Content_Types].xml", "<Types/>"}, zipEntry{"word/document.xml", "<w/>"}), FileTypeDocx},
+		{"xlsx", zipFile(t, zipEntry{"[Content_Types].xml", "<Types/>"}, zipEntry{"xl/workbook.xml", "<x/>"}), FileTypeXlsx},
+		{"pptx", zipFile(t, zipEntry{"[Content_Types].xml", "<Types/>"}, zipEntry{"ppt/presentation.xml", "<p/>"}), FileTypePptx},
+		{"docx streamed", streamZipFile(t, "[Content_Types].xml", "word/document.xml"), FileTypeDocx},
+		{"epub", zipFile(t, zipEntry{"mimetype", "application/epub+zip"}, zipEntry{"META-INF/container.xml", "<c/>"}), FileTypeEpub},
+		{"apk", zipFile(t, zipEntry{"AndroidManifest.xml", "\x03\x00"}, zipEntry{"classes.dex", "dex"}), FileTypeApk},
+		{"jar", zipFile(t, zipEntry{"META-INF/MANIFEST.MF", "Manifest-Version: 1.0\n"}, zipEntry{"a/A.class", "\xCA\xFE\xBA\xBE"}), FileTypeJar},
+		{"zip", zipFile(t, zipEntry{"a.txt", "a"}, zipEntry{"b.txt", "b"}), FileTypeZip},
+		{"zip header only", zipHead, FileTypeZip},
+		{"jpeg", jpeg, FileType{Extension: "jpg", MIME: "image/jpeg"}},
+		{"dat jpeg", xorBytes(jpeg, 0x37), FileTypeDat},
+		{"dat png", xorBytes(png, 0xA1), FileTypeDat},
+		{"dat too short", xorBytes(jpeg[:2], 0x37), FileTypeUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Sniff(tt.buf)
+			if got.Extension != tt.want.Extension {
+				t.Errorf("extension = %q, want %q", got.Extension, tt.want.Extension)
+			}
+			if got.MIME != tt.want.MIME {
+				t.Errorf("MIME = %q, want %q", got.MIME, tt.want.MIME)
+			}
+		})
+	}
+}
+
+func TestSniffCfb(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  []byte
+		want FileType
+		ok   bool
+	}{
+		{"doc", cfbFile([]byte{0xEC, 0xA5, 0xC1, 0x00}, 1024), FileTypeDoc, true},
+		{"xls by 0xfd 516 zero", cfbFile([]byte{0xFD, 0xFF, 0xFF, 0xFF, 0x00, 0x00, 0x00}, 1024), FileTypeXls, true},
+		{"xls by 0xfd 516 two", cfbFile([]byte{0xFD, 0xFF, 0xFF, 0xFF, 0x02, 0x00, 0x00}, 1024), FileTypeXls, true},
+		{"ppt by 0xfd 517 518", cfbFile([]byte{0xFD, 0xFF, 0xFF, 0xFF, 0x0E, 0x00, 0x00}, 1024), FileTypePpt, true},
+		{"not cfb", []byte("plain text"), FileTypeUnknown, false},
+		// undecided compound file left to later matchers
+		{"unknown marker", cfbFile([]byte{0x01, 0x02, 0x03, 0x04}, 1024), FileTypeUnknown, false},
+		{"doc marker truncated", cfbFile([]byte{0xEC, 0xA5, 0xC1, 0x00}, 514), FileTypeUnknown, false},
+		{"xls marker truncated", cfbFile([]byte{0x09, 0x08, 0x10, 0x00, 0x00, 0x06, 0x05, 0x00}, 519), FileTypeUnknown, false},
+		{"0xfd without byte 516", cfbFile([]byte{0xFD, 0xFF, 0xFF, 0xFF}, 516), FileTypeUnknown, false},
+		{"0xfd without byte 518", cfbFile([]byte{0xFD, 0xFF, 0xFF, 0xFF, 0x0E, 0x00}, 518), FileTypeUnknown, false},
+		{"cfb header only", cfbHead, FileTypeUnknown, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := sniffCfb(tt.buf)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("sniffCfb = %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDatKey(t *testing.T) {
+	jpeg := []byte{0xFF, 0xD8, 0xFF, 0xE0}
+	tests := []struct {
+		name string
+		buf  []byte
+		key  byte
+		ok   bool
+	}{
+		{"xor jpeg", xorBytes(jpeg, 0x5A), 0x5A, true},
+		{"plain jpeg", jpeg, 0, false},
+		{"empty", nil, 0, false},
+		{"random", []byte{0x01, 0x02, 0x03, 0x04}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ok := DatKey(tt.buf)
+			if key != tt.key || ok != tt.ok {
+				t.Errorf("DatKey = %#x %v, want %#x %v", key, ok, tt.key, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dustin/go-humanize"
+	"github.com/urfave/cli/v2"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var StatsCommand = &cli.Command{
+	Name:   "stats",
+	Usage:  "message statistics per conversation and overall",
+	Action: actionStats,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "db",
+			Usage:   "decrypted Backup.db file path",
+			Value:   "Backup.db",
+			Aliases: []string{"d"},
+		},
+		&cli.StringFlag{
+			Name:     "resource",
+			Usage:    "BAK_0_XXX folder path",
+			Required: true,
+			Aliases:  []string{"r"},
+		},
+		&cli.StringFlag{
+			Name:    "talker",
+			Usage:   "only count talker messages default all sessions",
+			Aliases: []string{"t"},
+		},
+		&cli.StringFlag{
+			Name:     "pass",
+			Usage:    "decrypt media resource file chunk key",
+			Required: true,
+			Aliases:  []string{"p"},
+		},
+		&cli.StringFlag{
+			Name:    "format",
+			Usage:   "output format table, csv or json",
+			Value:   "table",
+			Aliases: []string{"f"},
+		},
+		&cli.IntFlag{
+			Name:  "top",
+			Usage: "rows of top senders, stickers and busiest days in table",
+			Value: 10,
+		},
+		&cli.StringFlag{
+			Name:    "output",
+			Usage:   "output file default stdout",
+			Aliases: []string{"o"},
+		},
+	},
+}
+
+// responseWindow reply later than this be treated as new conversation
+const responseWindow = 12 * time.Hour
+
+type Stats struct {
+	Talker   string
+	Name     string
+	Messages int
+	// Sent Received non system message count by direction
+	Sent     int
+	Received int
+	First    time.Time
+	Last     time.Time
+	Types    map[string]int
+	Senders  map[string]int
+	// Daily message count keyed by 2006-01-02
+	Daily  map[string]int
+	Hourly [24]int
+	// AverageResponse seconds between message and reply from another sender
+	AverageResponse float64
+	Responses       int
+	Stickers        map[string]int
+	MediaBytes      map[string]int64
+	// LongestStreak consecutive days with message
+	LongestStreak int
+	StreakStart   string
+	StreakEnd     string
+
+	responseTotal time.Duration
+	prev          *Message
+}
+
+func NewStats(talker, name string) *Stats {
+	return &Stats{
+		Talker:     talker,
+		Name:       name,
+		Types:      make(map[string]int),
+		Senders:    make(map[string]int),
+		Daily:      make(map[string]int),
+		Stickers:   make(map[string]int),
+		MediaBytes: make(map[string]int64),
+	}
+}
+
+// Add count message, sizes media length keyed by MediaIdStr
+func (s *Stats) Add(m *Message, sizes map[string]int64) {
+	s.Messages++
+	if s.First.IsZero() || m.Time.Before(s.First) {
+		s.First = m.Time
+	}
+	if m.Time.After(s.Last) {
+		s.Last = m.Time
+	}
+
+	kind := m.TypeName()
+	s.Types[kind]++
+	s.Daily[m.Time.Format("2006-01-02")]++
+	s.Hourly[m.Time.Hour()]++
+
+	for i := 0; i < len(m.MediaIds); i++ {
+		s.MediaBytes[kind] += sizes[m.MediaIds[i]]
+	}
+
+	if m.Type == 47 && m.Xml != nil && m.Xml.Emoji != nil {
+		s.Stickers[m.Xml.Emoji.MD5]++
+	}
+
+	if m.Type == 10000 || m.Type == 10002 {
+		return
+	}
+	s.Senders[m.Sender]++
+	if m.Direction == Outgoing {
+		s.Sent++
+	} else {
+		s.Received++
+	}
+
+	// response never cross conversation
+	if prev := s.prev; prev != nil && prev.Talker == m.Talker && prev.Sender != m.Sender {
+		if gap := m.Time.Sub(prev.Time); gap >= 0 && gap <= responseWindow {
+			s.responseTotal += gap
+			s.Responses++
+		}
+	}
+	s.prev = m
+}
+
+// Finish compute average response time and streak
+func (s *Stats) Finish() {
+	if s.Responses > 0 {
+		s.AverageResponse = (s.responseTotal / time.Duration(s.Responses)).Seconds()
+	}
+
+	days := make([]string, 0, len(s.Daily))
+	for day := range s.Daily {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+
+	var start, prev time.Time
+	for i := 0; i < len(days); i++ {
+		day, _ := time.Parse("2006-01-02", days[i])
+		if prev.IsZero() || day.Sub(prev) != 24*time.Hour {
+			start = day
+		}
+		prev = day
+		if streak := int(day.Sub(start)/(24*time.Hour)) + 1; streak > s.LongestStreak {
+			s.LongestStreak = streak
+			s.StreakStart = start.Format("2006-01-02")
+			s.StreakEnd = days[i]
+		}
+	}
+}
+
+func (s *Stats) TotalMediaBytes() int64 {
+	var total int64
+	for _, size := range s.MediaBytes {
+		total += size
+	}
+	return total
+}
+
+type statsCount struct {
+	Key   string
+	Count int
+}
+
+// sortCounts descend by count then key
+func sortCounts(counts map[string]int) []statsCount {
+	result := make([]statsCount, 0, len(counts))
+	for key, count := range counts {
+		result = append(result, statsCount{key, count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+func formatResponse(seconds float64) string {
+	if seconds == 0 {
+		return ""
+	}
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
+func histogramBar(count, max int) string {
+	if max == 0 {
+		return ""
+	}
+	return strings.Repeat("#", (count*40+max-1)/max)
+}
+
+func writeStatsTable(w io.Writer, global *Stats, conversations []*Stats, name func(string) string, top int) error {
+	limit := func(n int) int {
+		if top > 0 && n > top {
+			return top
+		}
+		return n
+	}
+
+	rows := make([][]string, 0, len(conversations))
+	for i := 0; i < len(conversations); i++ {
+		s := conversations[i]
+		rows = append(rows, []string{
+			s.Talker,
+			s.Name,
+			strconv.Itoa(s.Messages),
+			strconv.Itoa(s.Sent),
+			strconv.Itoa(s.Received),
+			formatDate(s.First),
+			formatDate(s.Last),
+			formatResponse(s.AverageResponse),
+			strconv.Itoa(s.LongestStreak),
+			humanize.Bytes(uint64(s.TotalMediaBytes())),
+		})
+	}
+	rows = append(rows, []string{
+		"", "Total",
+		strconv.Itoa(global.Messages),
+		strconv.Itoa(global.Sent),
+		strconv.Itoa(global.Received),
+		formatDate(global.First),
+		formatDate(global.Last),
+		formatResponse(global.AverageResponse),
+		strconv.Itoa(global.LongestStreak),
+		humanize.Bytes(uint64(global.TotalMediaBytes())),
+	})
+	if err := writeTable(w, []string{"Talker", "Name", "Messages", "Sent", "Received", "First", "Last", "AvgResponse", "Streak", "Media"}, rows); err != nil {
+		return err
+	}
+
+	types := sortCounts(global.Types)
+	rows = rows[:0]
+	for i := 0; i < len(types); i++ {
+		rows = append(rows, []string{types[i].Key, strconv.Itoa(types[i].Count), humanize.Bytes(uint64(global.MediaBytes[types[i].Key]))})
+	}
+	if err := writeTable(w, []string{"Type", "Messages", "Media"}, rows); err != nil {
+		return err
+	}
+
+	senders := sortCounts(global.Senders)
+	rows = rows[:0]
+	for i := 0; i < limit(len(senders)); i++ {
+		rows = append(rows, []string{senders[i].Key, name(senders[i].Key), strconv.Itoa(senders[i].Count)})
+	}
+	if err := writeTable(w, []string{"Sender", "Name", "Messages"}, rows); err != nil {
+		return err
+	}
+
+	stickers := sortCounts(global.Stickers)
+	rows = rows[:0]
+	for i := 0; i < limit(len(stickers)); i++ {
+		rows = append(rows, []string{stickers[i].Key, strconv.Itoa(stickers[i].Count)})
+	}
+	if err := writeTable(w, []string{"Sticker", "Count"}, rows); err != nil {
+		return err
+	}
+
+	days := sortCounts(global.Daily)
+	rows = rows[:0]
+	for i := 0; i < limit(len(days)); i++ {
+		rows = append(rows, []string{days[i].Key, strconv.Itoa(days[i].Count), histogramBar(days[i].Count, days[0].Count)})
+	}
+	if err := writeTable(w, []string{"Day", "Messages", ""}, rows); err != nil {
+		return err
+	}
+
+	max := 0
+	for hour := 0; hour < 24; hour++ {
+		if global.Hourly[hour] > max {
+			max = global.Hourly[hour]
+		}
+	}
+	rows = rows[:0]
+	for hour := 0; hour < 24; hour++ {
+		rows = append(rows, []string{fmt.Sprintf("%02d", hour), strconv.Itoa(global.Hourly[hour]), histogramBar(global.Hourly[hour], max)})
+	}
+	return writeTable(w, []string{"Hour", "Messages", ""}, rows)
+}
+
+// statsRows flatten metrics into talker,metric,key,value rows
+func statsRows(s *Stats) [][]string {
+	talker := s.Talker
+	if talker == "" {
+		talker = "*"
+	}
+	var rows [][]string
+	add := func(metric, key, value string) {
+		rows = append(rows, []string{talker, metric, key, value})
+	}
+
+	add("messages", "", strconv.Itoa(s.Messages))
+	add("sent", "", strconv.Itoa(s.Sent))
+	add("received", "", strconv.Itoa(s.Received))
+	add("first", "", formatDate(s.First))
+	add("last", "", formatDate(s.Last))
+	add("average_response", "", strconv.FormatFloat(s.AverageResponse, 'f', 0, 64))
+	add("longest_streak", s.StreakStart+"/"+s.StreakEnd, strconv.Itoa(s.LongestStreak))
+	for _, c := range sortCounts(s.Types) {
+		add("type", c.Key, strconv.Itoa(c.Count))
+	}
+	for _, c := range sortCounts(s.Senders) {
+		add("sender", c.Key, strconv.Itoa(c.Count))
+	}
+	for _, c := range sortCounts(s.Stickers) {
+		add("sticker", c.Key, strconv.Itoa(c.Count))
+	}
+	kinds := make([]string, 0, len(s.MediaBytes))
+	for kind := range s.MediaBytes {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		add("media_bytes", kind, strconv.FormatInt(s.MediaBytes[kind], 10))
+	}
+	days := make([]string, 0, len(s.Daily))
+	for day := range s.Daily {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+	for _, day := range days {
+		add("daily", day, strconv.Itoa(s.Daily[day]))
+	}
+	for hour := 0; hour < 24; hour++ {
+		add("hourly", fmt.Sprintf("%02d", hour), strconv.Itoa(s.Hourly[hour]))
+	}
+	return rows
+}
+
+func actionStats(ctx *cli.Context) error {
+	dbName := ctx.String("db")
+	resource := ctx.String("resource")
+	talker := ctx.String("talker")
+	pass := Pass(ctx.String("pass"))
+	format := ctx.String("format")
+	top := ctx.Int("top")
+	output := ctx.String("output")
+	if !pass.Valid() {
+		return ErrInvalidPassKey
+	}
+	if format != "table" && format != "csv" && format != "json" {
+		return errors.New("unsupported format " + format)
+	}
+
+	defer releaseFds()
+
+	db, err := NewBackupDB(dbName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	book, err := NewContactBook(db)
+	if err != nil {
+		return err
+	}
+
+	sizes, err := db.MediaSizes()
+	if err != nil {
+		return err
+	}
+
+	talkers, err := selectTalkers(db, talker)
+	if err != nil {
+		return err
+	}
+
+	owner, err := detectOwner(db, resource, pass)
+	if err != nil {
+		return err
+	}
+
+	global := NewStats("", "")
+	var conversations []*Stats
+	for i := 0; i < len(talkers); i++ {
+		messages, err := loadMessages(db, resource, pass, talkers[i], book, LoadOptions{Owner: owner})
+		if err != nil {
+			return err
+		}
+		stats := NewStats(talkers[i], book.Name(talkers[i]))
+		for j := 0; j < len(messages); j++ {
+			stats.Add(messages[j], sizes)
+			global.Add(messages[j], sizes)
+		}
+		stats.Finish()
+		conversations = append(conversations, stats)
+	}
+	global.Finish()
+
+	sort.SliceStable(conversations, func(i, j int) bool {
+		return conversations[i].Messages > conversations[j].Messages
+	})
+
+	w, err := createOutput(output)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	switch format {
+	case "json":
+		return writeJSON(w, struct {
+			Global        *Stats
+			Conversations []*Stats
+		}{global, conversations})
+	case "csv":
+		rows := statsRows(global)
+		for i := 0; i < len(conversations); i++ {
+			rows = append(rows, statsRows(conversations[i])...)
+		}
+		return writeCSV(w, []string{"Talker", "Metric", "Key", "Value"}, rows)
+	}
+
+	return writeStatsTable(w, global, conversations, book.Name, top)
+}
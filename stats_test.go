@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatsStreak(t *testing.T) {
+	tests := []struct {
+		name    string
+		days    []string
+		longest int
+		start   string
+		end     string
+	}{
+		{"empty", nil, 0, "", ""},
+		{"single day", []string{"2023-03-01"}, 1, "2023-03-01", "2023-03-01"},
+		{"consecutive", []string{"2023-03-01", "2023-03-02", "2023-03-03"}, 3, "2023-03-01", "2023-03-03"},
+		{"gap reset", []string{"2023-03-01", "2023-03-02", "2023-03-05", "2023-03-06", "2023-03-07"}, 3, "2023-03-05", "2023-03-07"},
+		{"first longest kept on tie", []string{"2023-03-01", "2023-03-02", "2023-03-04", "2023-03-05"}, 2, "2023-03-01", "2023-03-02"},
+		{"month boundary", []string{"2023-02-27", "2023-02-28", "2023-03-01"}, 3, "2023-02-27", "2023-03-01"},
+		{"year boundary", []string{"2022-12-31", "2023-01-01"}, 2, "2022-12-31", "2023-01-01"},
+		{"unordered", []string{"2023-03-03", "2023-03-01", "2023-03-02"}, 3, "2023-03-01", "2023-03-03"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStats("wxid_a", "Alice")
+			for _, day := range tt.days {
+				s.Daily[day]++
+			}
+			s.Finish()
+			if s.LongestStreak != tt.longest || s.StreakStart != tt.start || s.StreakEnd != tt.end {
+				t.Errorf("streak = %d %s..%s, want %d %s..%s",
+					s.LongestStreak, s.StreakStart, s.StreakEnd, tt.longest, tt.start, tt.end)
+			}
+		})
+	}
+}
+
+func TestStatsResponse(t *testing.T) {
+	base := time.Date(2023, 3, 1, 9, 0, 0, 0, time.Local)
+	type msg struct {
+		talker string
+		sender string
+		typ    uint32
+		after  time.Duration
+	}
+	tests := []struct {
+		name      string
+		messages  []msg
+		responses int
+		average   float64
+	}{
+		{"no reply", []msg{
+			{"wxid_a", "wxid_a", 1, 0},
+			{"wxid_a", "wxid_a", 1, time.Minute},
+		}, 0, 0},
+		{"reply", []msg{
+			{"wxid_a", "wxid_a", 1, 0},
+			{"wxid_a", "wxid_me", 1, time.Minute},
+			{"wxid_a", "wxid_a", 1, 4 * time.Minute},
+		}, 2, 120},
+		{"reply measured from last message of burst", []msg{
+			{"wxid_a", "wxid_a", 1, 0},
+			{"wxid_a", "wxid_a", 1, 10 * time.Minute},
+			{"wxid_a", "wxid_me", 1, 11 * time.Minute},
+		}, 1, 60},
+		{"reply after window be new conversation", []msg{
+			{"wxid_a", "wxid_a", 1, 0},
+			{"wxid_a", "wxid_me", 1, responseWindow + time.Second},
+		}, 0, 0},
+		{"reply at window edge", []msg{
+			{"wxid_a", "wxid_a", 1, 0},
+			{"wxid_a", "wxid_me", 1, responseWindow},
+		}, 1, responseWindow.Seconds()},
+		{"system message ignored", []msg{
+			{"wxid_a", "wxid_a", 1, 0},
+			{"wxid_a", "", 10000, 30 * time.Second},
+			{"wxid_a", "wxid_me", 1, time.Minute},
+		}, 1, 60},
+		{"never cross conversation", []msg{
+			{"wxid_a", "wxid_a", 1, 0},
+			{"wxid_b", "wxid_me", 1, time.Minute},
+		}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStats("", "")
+			for i, m := range tt.messages {
+				s.Add(&Message{
+					Id:     uint64(i + 1),
+					Type:   m.typ,
+					Talker: m.talker,
+					Sender: m.sender,
+					Time:   base.Add(m.after),
+				}, nil)
+			}
+			s.Finish()
+			if s.Responses != tt.responses || s.AverageResponse != tt.average {
+				t.Errorf("responses = %d average %v, want %d average %v", s.Responses, s.AverageResponse, tt.responses, tt.average)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strings"
+)
+
+// MessageStatus delivery state decoded from msgStatus
+type MessageStatus int
+
+const (
+	StatusUnknown MessageStatus = iota
+	StatusSending
+	StatusSent
+	StatusDelivered
+	StatusRead
+	StatusFailed
+	// StatusRevoked resolved by later revoke notice in same conversation
+	StatusRevoked
+)
+
+var statusNames = []string{"unknown", "sending", "sent", "delivered", "read", "failed", "revoked"}
+
+func (s MessageStatus) String() string {
+	if s < 0 || int(s) >= len(statusNames) {
+		return statusNames[StatusUnknown]
+	}
+	return statusNames[s]
+}
+
+func (s MessageStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func parseMessageStatus(status uint32) MessageStatus {
+	switch status {
+	case 1:
+		return StatusSending
+	case 2:
+		return StatusSent
+	case 3:
+		return StatusDelivered
+	case 4:
+		return StatusRead
+	case 5:
+		return StatusFailed
+	}
+	return StatusUnknown
+}
+
+// MessageFlags known mark of message, msgFlag itself be kept raw in Message.Flag
+type MessageFlags uint32
+
+const (
+	// FlagForwarded msgsource alnode fr or merged chat record
+	FlagForwarded MessageFlags = 1 << iota
+	// FlagSilent sent without notification
+	FlagSilent
+	// FlagUnknown msgFlag has bit of unknown meaning
+	FlagUnknown
+)
+
+var flagNames = []struct {
+	flag MessageFlags
+	name string
+}{
+	{FlagForwarded, "forwarded"},
+	{FlagSilent, "silent"},
+	{FlagUnknown, "unknown-flag"},
+}
+
+// decodeMsgFlag no msgFlag bit has confirmed meaning yet, any set bit become FlagUnknown
+func decodeMsgFlag(msgFlag uint32) MessageFlags {
+	if msgFlag != 0 {
+		return FlagUnknown
+	}
+	return 0
+}
+
+func (f MessageFlags) Names() []string {
+	var names []string
+	for i := 0; i < len(flagNames); i++ {
+		if f&flagNames[i].flag != 0 {
+			names = append(names, flagNames[i].name)
+		}
+	}
+	return names
+}
+
+func (f MessageFlags) String() string {
+	return strings.Join(f.Names(), ",")
+}
+
+func (f MessageFlags) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+func (m *Message) decodeFlags() {
+	m.Flags |= decodeMsgFlag(m.Flag)
+	if m.Source != nil && m.Source.AlNode != nil && m.Source.AlNode.Fr > 0 {
+		m.Flags |= FlagForwarded
+	}
+	if m.Silence() {
+		m.Flags |= FlagSilent
+	}
+	if m.Record != nil {
+		m.Flags |= FlagForwarded
+	}
+}
+
+// HasState match status name or any flag name
+func (m *Message) HasState(name string) bool {
+	if m.Status.String() == name {
+		return true
+	}
+	names := m.Flags.Names()
+	for i := 0; i < len(names); i++ {
+		if names[i] == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDecodeFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  MessageStatus
+		msgFlag uint32
+		source  *XmlMsgSource
+		want    string
+	}{
+		{"none", StatusSent, 0, nil, ""},
+		{"unknown status without flag", StatusUnknown, 0, nil, ""},
+		{"unknown bit", StatusSent, 0x10, nil, "unknown-flag"},
+		{"forwarded", StatusRead, 0, &XmlMsgSource{AlNode: &XmlMsgSourceAlNode{Fr: 1}}, "forwarded"},
+		{"silent and unknown bit", StatusSent, 0x3, &XmlMsgSource{Silence: 1}, "silent,unknown-flag"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Message{Status: tt.status, Flag: tt.msgFlag, Source: tt.source}
+			m.decodeFlags()
+			if got := m.Flags.String(); got != tt.want {
+				t.Errorf("Flags = %q, want %q", got, tt.want)
+			}
+			if got, want := m.HasState("unknown-flag"), tt.msgFlag != 0; got != want {
+				t.Errorf("HasState(unknown-flag) = %v, want %v", got, want)
+			}
+			if got, want := m.HasState("unknown"), tt.status == StatusUnknown; got != want {
+				t.Errorf("HasState(unknown) = %v, want %v", got, want)
+			}
+			if !m.HasState(tt.status.String()) {
+				t.Errorf("HasState(%s) false", tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type SystemEventKind int
+
+const (
+	EventNotice SystemEventKind = iota
+	EventRevoke
+	EventMemberJoined
+	EventMemberLeft
+	EventGroupRenamed
+	EventPat
+	EventTransferAccepted
+	EventRedPacket
+)
+
+func (k SystemEventKind) String() string {
+	switch k {
+	case EventRevoke:
+		return "Revoke"
+	case EventMemberJoined:
+		return "MemberJoined"
+	case EventMemberLeft:
+		return "MemberLeft"
+	case EventGroupRenamed:
+		return "GroupRenamed"
+	case EventPat:
+		return "Pat"
+	case EventTransferAccepted:
+		return "TransferAccepted"
+	case EventRedPacket:
+		return "RedPacket"
+	}
+	return "Notice"
+}
+
+// SystemEvent decoded type 10000 and 10002 message, Actor and Targets
+// be username from sysmsg xml or display name from plain notice
+type SystemEvent struct {
+	Kind    SystemEventKind
+	Actor   string
+	Targets []string
+	// MsgId revoked message new msg id
+	MsgId uint64
+	// Name new group name
+	Name string
+	// Suffix pat suffix
+	Suffix string
+	// Text original notice text
+	Text string
+	// Display resolved readable line
+	Display string
+}
+
+type noticePattern struct {
+	kind SystemEventKind
+	re   *regexp.Regexp
+	// submatch index of actor target and name, 0 means absent
+	actor, target, name int
+}
+
+var noticePatterns = []noticePattern{
+	{EventRevoke, regexp.MustCompile(`^"?(.+?)"? ?撤回了一条消息`), 1, 0, 0},
+	{EventRevoke, regexp.MustCompile(`^"?(.+?)"? recalled a message`), 1, 0, 0},
+	{EventMemberJoined, regexp.MustCompile(`^"?(.+?)"?邀请"(.+)"加入了群聊`), 1, 2, 0},
+	{EventMemberJoined, regexp.MustCompile(`^"?(.+?)"? invited "(.+)" to (?:the )?group chat`), 1, 2, 0},
+	{EventMemberJoined, regexp.MustCompile(`^"(.+?)"通过扫描"?(.+?)"?分享的二维码加入群聊`), 2, 1, 0},
+	{EventMemberJoined, regexp.MustCompile(`^"(.+?)" joined (?:the )?group chat via the QR code shared by "?(.+?)"?$`), 2, 1, 0},
+	{EventMemberLeft, regexp.MustCompile(`^"?(.+?)"?将"(.+)"移出了群聊`), 1, 2, 0},
+	{EventMemberLeft, regexp.MustCompile(`^"?(.+?)"? removed "(.+)" from (?:the )?group chat`), 1, 2, 0},
+	{EventMemberLeft, regexp.MustCompile(`^"(.+?)"退出了群聊`), 0, 1, 0},
+	{EventGroupRenamed, regexp.MustCompile(`^"?(.+?)"?修改群名为[“"](.+)[”"]`), 1, 0, 2},
+	{EventGroupRenamed, regexp.MustCompile(`^"?(.+?)"? changed the group name to [“"](.+)[”"]`), 1, 0, 2},
+	{EventPat, regexp.MustCompile(`^"?(.+?)"? ?拍了拍 ?"?(.+?)"?$`), 1, 2, 0},
+	{EventPat, regexp.MustCompile(`^"?(.+?)"? (?:patted|tickled) "?(.+?)"?$`), 1, 2, 0},
+	{EventRedPacket, regexp.MustCompile(`^.+领取了.*的红包$`), 0, 0, 0},
+	{EventRedPacket, regexp.MustCompile(`红包已被领(?:取|完)`), 0, 0, 0},
+	{EventRedPacket, regexp.MustCompile(`(?i)^.+ opened (?:your|.+'s) red packet$`), 0, 0, 0},
+	{EventTransferAccepted, regexp.MustCompile(`^(?:你)?已收款`), 0, 0, 0},
+	{EventTransferAccepted, regexp.MustCompile(`(?i)^transfer (?:accepted|received)`), 0, 0, 0},
+}
+
+func splitNames(names string) []string {
+	var result []string
+	parts := strings.FieldsFunc(names, func(r rune) bool {
+		return r == '、' || r == ','
+	})
+	for i := 0; i < len(parts); i++ {
+		if name := strings.Trim(strings.TrimSpace(parts[i]), `"`); name != "" {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// parseNotice decode plain text type 10000 message
+func parseNotice(content string) *SystemEvent {
+	event := &SystemEvent{Kind: EventNotice, Text: content}
+	text := strings.TrimSpace(content)
+
+	for i := 0; i < len(noticePatterns); i++ {
+		p := noticePatterns[i]
+		match := p.re.FindStringSubmatch(text)
+		if match == nil {
+			continue
+		}
+		event.Kind = p.kind
+		if p.actor > 0 {
+			event.Actor = match[p.actor]
+		}
+		if p.target > 0 {
+			event.Targets = splitNames(match[p.target])
+		}
+		if p.name > 0 {
+			event.Name = match[p.name]
+		}
+		return event
+	}
+
+	return event
+}
+
+func templateMembers(template *XmlSysMsgContentTemplate, name string) []string {
+	var users []string
+	for i := 0; i < len(template.LinkList); i++ {
+		link := template.LinkList[i]
+		if link.Name != name {
+			continue
+		}
+		for j := 0; j < len(link.MemberList); j++ {
+			users = append(users, link.MemberList[j].UserName)
+		}
+		users = append(users, link.UserNames...)
+	}
+	return users
+}
+
+// renderTemplate replace $name$ placeholder with member nickname
+func renderTemplate(template *XmlSysMsgContentTemplate) string {
+	text := template.Template
+	for i := 0; i < len(template.LinkList); i++ {
+		link := template.LinkList[i]
+		var names []string
+		for j := 0; j < len(link.MemberList); j++ {
+			member := link.MemberList[j]
+			if member.NickName != "" {
+				names = append(names, member.NickName)
+			} else {
+				names = append(names, member.UserName)
+			}
+		}
+		if len(names) == 0 {
+			names = append(names, link.Title)
+		}
+		separator := link.Separator
+		if separator == "" {
+			separator = "、"
+		}
+		text = strings.ReplaceAll(text, "$"+link.Name+"$", strings.Join(names, separator))
+	}
+	return text
+}
+
+// parseSysMsg decode xml type 10002 message
+func parseSysMsg(sysMsg *XmlSysMsg) *SystemEvent {
+	event := &SystemEvent{Kind: EventNotice}
+
+	switch {
+	case sysMsg.RevokeMsg != nil:
+		event.Kind = EventRevoke
+		event.MsgId = sysMsg.RevokeMsg.NewMsgId
+		event.Text = sysMsg.RevokeMsg.ReplaceMsg
+		if revoke := parseNotice(event.Text); revoke.Kind == EventRevoke {
+			event.Actor = revoke.Actor
+		}
+	case sysMsg.Pat != nil:
+		event.Kind = EventPat
+		event.Actor = sysMsg.Pat.FromUserName
+		event.Targets = []string{sysMsg.Pat.PattedUserName}
+		event.Suffix = sysMsg.Pat.PatSuffix
+		event.Text = sysMsg.Pat.Template
+	case sysMsg.SysMsgTemplate != nil && sysMsg.SysMsgTemplate.ContentTemplate != nil:
+		template := sysMsg.SysMsgTemplate.ContentTemplate
+		event.Text = renderTemplate(template)
+		notice := parseNotice(event.Text)
+		event.Kind = notice.Kind
+		event.Name = notice.Name
+		if actor := templateMembers(template, "username"); len(actor) > 0 {
+			event.Actor = actor[0]
+		} else if actor = templateMembers(template, "from"); len(actor) > 0 {
+			event.Actor = actor[0]
+		} else {
+			event.Actor = notice.Actor
+		}
+		for _, name := range []string{"names", "kickoutname", "adder"} {
+			event.Targets = append(event.Targets, templateMembers(template, name)...)
+		}
+		if len(event.Targets) == 0 {
+			event.Targets = notice.Targets
+		}
+	}
+
+	return event
+}
+
+func joinNames(users []string, name func(string) string) string {
+	names := make([]string, 0, len(users))
+	for i := 0; i < len(users); i++ {
+		names = append(names, name(users[i]))
+	}
+	return strings.Join(names, ", ")
+}
+
+func (e *SystemEvent) Resolve(name func(string) string) {
+	e.Display = e.Line(name)
+}
+
+func (e *SystemEvent) String() string {
+	if e.Display != "" {
+		return e.Display
+	}
+	return e.Line(func(user string) string {
+		return user
+	})
+}
+
+// Line short readable system line, name resolve username to display name
+func (e *SystemEvent) Line(name func(string) string) string {
+	actor := name(e.Actor)
+	targets := joinNames(e.Targets, name)
+
+	switch e.Kind {
+	case EventRevoke:
+		line := actor + " recalled a message"
+		if e.Actor == "" {
+			line = "message recalled"
+		}
+		if e.MsgId != 0 {
+			line += " #" + strconv.FormatUint(e.MsgId, 10)
+		}
+		return line
+	case EventMemberJoined:
+		if e.Actor == "" {
+			return targets + " joined the group"
+		}
+		return actor + " invited " + targets + " to the group"
+	case EventMemberLeft:
+		if e.Actor == "" {
+			return targets + " left the group"
+		}
+		return actor + " removed " + targets + " from the group"
+	case EventGroupRenamed:
+		return actor + " renamed the group to \"" + e.Name + "\""
+	case EventPat:
+		return actor + " patted " + targets + e.Suffix
+	}
+
+	return e.Text
+}
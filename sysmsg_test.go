@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNotice(t *testing.T) {
+	tests := []struct {
+		text    string
+		kind    SystemEventKind
+		actor   string
+		targets []string
+		name    string
+	}{
+		{`"Alice" 撤回了一条消息`, EventRevoke, "Alice", nil, ""},
+		{`你撤回了一条消息`, EventRevoke, "你", nil, ""},
+		{`"Bob" recalled a message`, EventRevoke, "Bob", nil, ""},
+		{`You recalled a message`, EventRevoke, "You", nil, ""},
+		{`"Alice"邀请"Bob、Carol"加入了群聊`, EventMemberJoined, "Alice", []string{"Bob", "Carol"}, ""},
+		{`你邀请"Bob"加入了群聊`, EventMemberJoined, "你", []string{"Bob"}, ""},
+		{`"Alice" invited "Bob, Carol" to the group chat`, EventMemberJoined, "Alice", []string{"Bob", "Carol"}, ""},
+		{`"Bob"通过扫描"Alice"分享的二维码加入群聊`, EventMemberJoined, "Alice", []string{"Bob"}, ""},
+		{`"Bob" joined the group chat via the QR code shared by "Alice"`, EventMemberJoined, "Alice", []string{"Bob"}, ""},
+		{`你将"Bob"移出了群聊`, EventMemberLeft, "你", []string{"Bob"}, ""},
+		{`"Alice" removed "Bob" from the group chat`, EventMemberLeft, "Alice", []string{"Bob"}, ""},
+		{`"Bob"退出了群聊`, EventMemberLeft, "", []string{"Bob"}, ""},
+		{`"Alice"修改群名为“Weekend Trip”`, EventGroupRenamed, "Alice", nil, "Weekend Trip"},
+		{`"Alice" changed the group name to "Weekend Trip"`, EventGroupRenamed, "Alice", nil, "Weekend Trip"},
+		{`"Alice" 拍了拍 "Bob"`, EventPat, "Alice", []string{"Bob"}, ""},
+		{`"Alice" patted "Bob"`, EventPat, "Alice", []string{"Bob"}, ""},
+		{`"Alice" tickled Bob`, EventPat, "Alice", []string{"Bob"}, ""},
+		{`我拍了拍"Bob"`, EventPat, "我", []string{"Bob"}, ""},
+		{`你拍了拍自己`, EventPat, "你", []string{"自己"}, ""},
+		{`  "Alice" recalled a message  `, EventRevoke, "Alice", nil, ""},
+		{`你领取了Alice的红包`, EventRedPacket, "", nil, ""},
+		{`Alice opened your Red Packet`, EventRedPacket, "", nil, ""},
+		{`你已收款`, EventTransferAccepted, "", nil, ""},
+		{`Transfer accepted`, EventTransferAccepted, "", nil, ""},
+		{`Alice领取了你的红包`, EventRedPacket, "", nil, ""},
+		{`你的红包已被领完`, EventRedPacket, "", nil, ""},
+		{`请确认收款`, EventNotice, "", nil, ""},
+		{`You can transfer files to your phone`, EventNotice, "", nil, ""},
+		{`你发出了一个红包`, EventNotice, "", nil, ""},
+		{`Red packet expired`, EventNotice, "", nil, ""},
+		{`以上是打招呼的内容`, EventNotice, "", nil, ""},
+		{``, EventNotice, "", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			e := parseNotice(tt.text)
+			if e.Kind != tt.kind {
+				t.Errorf("kind = %s, want %s", e.Kind, tt.kind)
+			}
+			if e.Actor != tt.actor {
+				t.Errorf("actor = %q, want %q", e.Actor, tt.actor)
+			}
+			if !reflect.DeepEqual(e.Targets, tt.targets) {
+				t.Errorf("targets = %q, want %q", e.Targets, tt.targets)
+			}
+			if e.Name != tt.name {
+				t.Errorf("name = %q, want %q", e.Name, tt.name)
+			}
+			if e.Text != tt.text {
+				t.Errorf("text = %q, want original %q", e.Text, tt.text)
+			}
+		})
+	}
+}
+
+func TestSplitNames(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"Bob", []string{"Bob"}},
+		{`Bob、Carol`, []string{"Bob", "Carol"}},
+		{`"Bob", "Carol"`, []string{"Bob", "Carol"}},
+		{` , 、`, nil},
+	}
+	for _, tt := range tests {
+		if got := splitNames(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitNames(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
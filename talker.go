@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// closeMatches count of suggestion when nothing match
+const closeMatches = 5
+
+type talkerCandidate struct {
+	UserName string
+	NickName string
+	Alias    string
+}
+
+func (c *talkerCandidate) String() string {
+	s := c.UserName
+	if c.NickName != "" {
+		s += " (" + c.NickName + ")"
+	}
+	if c.Alias != "" {
+		s += " [" + c.Alias + "]"
+	}
+	return s
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for i := 1; i < len(values); i++ {
+		if values[i] < m {
+			m = values[i]
+		}
+	}
+	return m
+}
+
+// levenshtein edit distance by rune
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := 0; j <= len(rb); j++ {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func talkerCandidates(db *BackupDB) ([]*talkerCandidate, error) {
+	book, err := NewContactBook(db)
+	if err != nil {
+		return nil, err
+	}
+	talkers, err := selectTalkers(db, "")
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]*talkerCandidate, 0, len(talkers))
+	for i := 0; i < len(talkers); i++ {
+		c := &talkerCandidate{UserName: talkers[i]}
+		if contact := book.Contact(talkers[i]); contact != nil {
+			c.NickName, c.Alias = contact.NickName, contact.Alias
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, nil
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func promptTalker(in io.Reader, out io.Writer, query string, candidates []*talkerCandidate) (string, error) {
+	fmt.Fprintf(out, "%d talkers match %q:\n", len(candidates), query)
+	for i := 0; i < len(candidates); i++ {
+		fmt.Fprintf(out, "  %d) %s\n", i+1, candidates[i])
+	}
+	reader := bufio.NewReader(in)
+	for {
+		fmt.Fprintf(out, "select [1-%d]: ", len(candidates))
+		line, err := reader.ReadString('\n')
+		if n, convErr := strconv.Atoi(strings.TrimSpace(line)); convErr == nil && n >= 1 && n <= len(candidates) {
+			return candidates[n-1].UserName, nil
+		}
+		if err != nil {
+			return "", errors.New("no talker selected")
+		}
+	}
+}
+
+// matchTalkers split candidates by exact or partial match of lower query,
+// every name be checked for exact match before any partial one
+func matchTalkers(candidates []*talkerCandidate, lower string) (exact, partial []*talkerCandidate) {
+	for i := 0; i < len(candidates); i++ {
+		c := candidates[i]
+		names := []string{c.UserName, c.NickName, c.Alias}
+		contains := false
+		equal := false
+		for j := 0; j < len(names) && !equal; j++ {
+			name := strings.ToLower(names[j])
+			if name == "" {
+				continue
+			}
+			equal = name == lower
+			contains = contains || strings.Contains(name, lower)
+		}
+		if equal {
+			exact = append(exact, c)
+		} else if contains {
+			partial = append(partial, c)
+		}
+	}
+	return exact, partial
+}
+
+// resolveTalker accept username, nickname, alias or partial of them,
+// prompt on stdin when ambiguous
+func resolveTalker(db *BackupDB, query string) (string, error) {
+	candidates, err := talkerCandidates(db)
+	if err != nil {
+		return "", err
+	}
+
+	for i := 0; i < len(candidates); i++ {
+		if candidates[i].UserName == query {
+			return query, nil
+		}
+	}
+
+	lower := strings.ToLower(query)
+	exact, partial := matchTalkers(candidates, lower)
+	matches := exact
+	if len(matches) == 0 {
+		matches = partial
+	}
+	switch {
+	case len(matches) == 1:
+		return matches[0].UserName, nil
+	case len(matches) > 1 && isTerminal(os.Stdin):
+		return promptTalker(os.Stdin, os.Stderr, query, matches)
+	case len(matches) > 1:
+		lines := make([]string, 0, len(matches))
+		for i := 0; i < len(matches); i++ {
+			lines = append(lines, "  "+matches[i].String())
+		}
+		return "", fmt.Errorf("talker %q is ambiguous, matches:\n%s", query, strings.Join(lines, "\n"))
+	}
+
+	distance := func(c *talkerCandidate) int {
+		d := levenshtein(lower, strings.ToLower(c.UserName))
+		if c.NickName != "" {
+			d = minInt(d, levenshtein(lower, strings.ToLower(c.NickName)))
+		}
+		if c.Alias != "" {
+			d = minInt(d, levenshtein(lower, strings.ToLower(c.Alias)))
+		}
+		return d
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return distance(candidates[i]) < distance(candidates[j])
+	})
+	lines := make([]string, 0, closeMatches)
+	for i := 0; i < len(candidates) && i < closeMatches; i++ {
+		lines = append(lines, "  "+candidates[i].String())
+	}
+	if len(lines) == 0 {
+		return "", fmt.Errorf("no talker match %q", query)
+	}
+	return "", fmt.Errorf("no talker match %q, close matches:\n%s", query, strings.Join(lines, "\n"))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMatchTalkers(t *testing.T) {
+	candidates := []*talkerCandidate{
+		{UserName: "wxid_bob1", NickName: "Bob"},
+		{UserName: "wxid_bobby", NickName: "Bobby"},
+		{UserName: "wxid_c", NickName: "Carol", Alias: "bob_fan"},
+		{UserName: "wxid_d", NickName: "Dave"},
+	}
+	tests := []struct {
+		query   string
+		exact   []string
+		partial []string
+	}{
+		{"bob", []string{"wxid_bob1"}, []string{"wxid_bobby", "wxid_c"}},
+		{"BOBBY", []string{"wxid_bobby"}, nil},
+		{"bob_fan", []string{"wxid_c"}, nil},
+		{"wxid_", nil, []string{"wxid_bob1", "wxid_bobby", "wxid_c", "wxid_d"}},
+		{"eve", nil, nil},
+	}
+	names := func(cs []*talkerCandidate) []string {
+		var s []string
+		for i := 0; i < len(cs); i++ {
+			s = append(s, cs[i].UserName)
+		}
+		return s
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			exact, partial := matchTalkers(candidates, strings.ToLower(tt.query))
+			if got := names(exact); !reflect.DeepEqual(got, tt.exact) {
+				t.Errorf("exact = %q, want %q", got, tt.exact)
+			}
+			if got := names(partial); !reflect.DeepEqual(got, tt.partial) {
+				t.Errorf("partial = %q, want %q", got, tt.partial)
+			}
+		})
+	}
+}
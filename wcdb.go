@@ -10,6 +10,8 @@ import (
 	"golang.org/x/crypto/pbkdf2"
 	"hash"
 	"io"
+	"sort"
+	"strings"
 )
 
 const (
@@ -150,7 +152,8 @@ func (w *SqlCipher) Data() (b []byte, err error) {
 }
 
 type BackupDB struct {
-	db *sql.DB
+	db     *sql.DB
+	schema *Schema
 }
 
 func NewBackupDB(filename string) (*BackupDB, error) {
@@ -159,122 +162,314 @@ func NewBackupDB(filename string) (*BackupDB, error) {
 		return nil, err
 	}
 
+	schema, err := probeSchema(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	b := &BackupDB{
-		db: db,
+		db:     db,
+		schema: schema,
 	}
 
 	return b, nil
 }
 
-func (db *BackupDB) Sessions() ([]Session, error) {
-	var sessions []Session
-	rows, err := db.db.Query("SELECT * FROM Session ORDER BY TotalSize DESC")
+// Schema detected table layout
+func (db *BackupDB) Schema() *Schema {
+	return db.schema
+}
+
+// selectRows query known columns of table, fn called after every row scanned into columns
+func (db *BackupDB) selectRows(table string, columns []column, clause string, fn func() error, args ...interface{}) error {
+	list, dest, err := db.schema.selectColumns(table, columns)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	rows, err := db.db.Query("SELECT "+list+" FROM "+table+" "+clause, args...)
+	if err != nil {
+		return err
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var session Session
-		if err = rows.Scan(&session.Talker, &session.EndTime, &session.TotalSize,
-			&session.NickName, &session.Reserved0, &session.Reserved1,
-			&session.Reserved2, &session.Reserved3, &session.StartTime,
-			&session.Reserved5); err != nil {
-			return nil, err
+		if err = rows.Scan(dest...); err != nil {
+			return err
+		}
+		if err = fn(); err != nil {
+			return err
 		}
+	}
+	return rows.Err()
+}
+
+func (db *BackupDB) Sessions() ([]Session, error) {
+	var sessions []Session
+	var session Session
+	if err := db.selectRows("Session", session.columns(), "", func() error {
 		sessions = append(sessions, session)
+		session = Session{}
+		return nil
+	}); err != nil {
+		return nil, err
 	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].TotalSize > sessions[j].TotalSize
+	})
 	return sessions, nil
 }
 
 func (db *BackupDB) Name2ID() ([]Name2ID, error) {
-	var sessions []Name2ID
-	rows, err := db.db.Query("SELECT * FROM Name2ID")
+	var ids []Name2ID
+	var id Name2ID
+	err := db.selectRows("Name2ID", id.columns(), "ORDER BY rowid", func() error {
+		ids = append(ids, id)
+		return nil
+	})
+	return ids, err
+}
+
+var ErrNoTalker = errors.New("no record")
+
+// TalkerId Name2ID rowid of username, which MsgSegments and MsgMedia refer as TalkerId
+func (db *BackupDB) TalkerId(name string) (int, error) {
+	cols, err := db.schema.columnNames("Name2ID", "UsrName")
+	if err != nil {
+		return -1, err
+	}
+	var id int
+	if err = db.db.QueryRow("SELECT rowid FROM Name2ID WHERE "+cols[0]+" = ?", name).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return -1, ErrNoTalker
+		}
+		return -1, err
+	}
+	return id, nil
+}
+
+// OrphanTalkerIds segment TalkerId without Name2ID row, messages of them can not be
+// reached by username
+func (db *BackupDB) OrphanTalkerIds() ([]int, error) {
+	cols, err := db.schema.columnNames("MsgSegments", "TalkerId")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.db.Query("SELECT DISTINCT s." + cols[0] + " FROM MsgSegments s " +
+		"LEFT JOIN Name2ID n ON n.rowid = s." + cols[0] + " WHERE n.rowid IS NULL ORDER BY 1")
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+	var orphans []int
 	for rows.Next() {
-		var session Name2ID
-		if err = rows.Scan(&session.UsrName); err != nil {
+		var id int
+		if err = rows.Scan(&id); err != nil {
 			return nil, err
 		}
-		sessions = append(sessions, session)
+		orphans = append(orphans, id)
 	}
-	return sessions, nil
+	return orphans, rows.Err()
 }
 
 func (db *BackupDB) MsgSegment(talkerId int) ([]MsgSegment, error) {
-	row, err := db.db.Query("SELECT * FROM MsgSegments WHERE talkerId = ?", talkerId)
+	cols, err := db.schema.columnNames("MsgSegments", "TalkerId")
 	if err != nil {
 		return nil, err
 	}
-	defer row.Close()
 	var msgs []MsgSegment
-	for row.Next() {
-		var msg MsgSegment
-		if err := row.Scan(&msg.TalkerId, &msg.StartTime, &msg.EndTime,
-			&msg.OffSet, &msg.Length, &msg.UsrName, &msg.Status,
-			&msg.Reserved1, &msg.FilePath, &msg.SegmentId, &msg.Reserved2,
-			&msg.Reserved3); err != nil {
-			return nil, err
-		}
+	var msg MsgSegment
+	err = db.selectRows("MsgSegments", msg.columns(), "WHERE "+cols[0]+" = ?", func() error {
 		msgs = append(msgs, msg)
-	}
-	return msgs, nil
+		msg = MsgSegment{}
+		return nil
+	}, talkerId)
+	return msgs, err
 }
 
 func (db *BackupDB) FileSegment(id int) ([]MsgFileSegment, error) {
+	cols, err := db.schema.columnNames("MsgFileSegment", "MapKey", "InnerOffSet")
+	if err != nil {
+		return nil, err
+	}
+	var files []MsgFileSegment
+	var f MsgFileSegment
+	err = db.selectRows("MsgFileSegment", f.columns(), "WHERE "+cols[0]+" = ? ORDER BY "+cols[1], func() error {
+		files = append(files, f)
+		f = MsgFileSegment{}
+		return nil
+	}, id)
+	return files, err
+}
+
+func (db *BackupDB) FileSegments() ([]MsgFileSegment, error) {
+	cols, err := db.schema.columnNames("MsgFileSegment", "MapKey", "InnerOffSet")
+	if err != nil {
+		return nil, err
+	}
 	var files []MsgFileSegment
-	rows, err := db.db.Query("SELECT * FROM MsgFileSegment WHERE MapKey = ? ORDER BY InnerOffset", id)
+	var f MsgFileSegment
+	err = db.selectRows("MsgFileSegment", f.columns(), "ORDER BY "+strings.Join(cols, ", "), func() error {
+		files = append(files, f)
+		f = MsgFileSegment{}
+		return nil
+	})
+	return files, err
+}
+
+// MediaSizes total length of every media file keyed by MediaIdStr
+func (db *BackupDB) MediaSizes() (map[string]int64, error) {
+	media, err := db.schema.columnNames("MsgMedia", "MediaIdStr", "MediaId")
+	if err != nil {
+		return nil, err
+	}
+	file, err := db.schema.columnNames("MsgFileSegment", "MapKey", "TotalLen")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.db.Query("SELECT m." + media[0] + ", MAX(f." + file[1] + ") FROM MsgMedia m " +
+		"JOIN MsgFileSegment f ON f." + file[0] + " = m." + media[1] + " GROUP BY m." + media[0])
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+	sizes := make(map[string]int64)
 	for rows.Next() {
-		var f MsgFileSegment
-		if err = rows.Scan(&f.MapKey, &f.InnerOffSet, &f.Length,
-			&f.TotalLen, &f.OffSet, &f.Reserved1, &f.FileName,
-			&f.Reserved2, &f.Reserved3, &f.Reserved4); err != nil {
+		var id string
+		var size int64
+		if err = rows.Scan(&id, &size); err != nil {
 			return nil, err
 		}
-		files = append(files, f)
+		sizes[id] = size
 	}
-	return files, nil
+	return sizes, rows.Err()
 }
 
-func (db *BackupDB) FileSegments() ([]MsgFileSegment, error) {
-	var files []MsgFileSegment
-	rows, err := db.db.Query("SELECT * FROM MsgFileSegment ORDER BY MapKey, InnerOffset")
+// TalkerMediaSizes total media length of every talker
+func (db *BackupDB) TalkerMediaSizes() (map[string]int64, error) {
+	media, err := db.schema.columnNames("MsgMedia", "Talker", "MediaId")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.db.Query("SELECT m." + media[0] + ", SUM(f.Size) FROM MsgMedia m " +
+		"JOIN (" + db.fileSizes() + ") f ON f.MapKey = m." + media[1] + " GROUP BY m." + media[0])
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+	sizes := make(map[string]int64)
 	for rows.Next() {
-		var f MsgFileSegment
-		if err = rows.Scan(&f.MapKey, &f.InnerOffSet, &f.Length,
-			&f.TotalLen, &f.OffSet, &f.Reserved1, &f.FileName,
-			&f.Reserved2, &f.Reserved3, &f.Reserved4); err != nil {
+		var talker string
+		var size int64
+		if err = rows.Scan(&talker, &size); err != nil {
 			return nil, err
 		}
-		files = append(files, f)
+		sizes[talker] = size
+	}
+	return sizes, rows.Err()
+}
+
+// Config decoded Config table entries, nil when backup has no Config table or its Key and Buf
+func (db *BackupDB) Config() ([]*ConfigEntry, error) {
+	if !db.schema.HasColumn("Config", "Key") || !db.schema.HasColumn("Config", "Buf") {
+		return nil, nil
+	}
+	var entries []*ConfigEntry
+	var c Config
+	err := db.selectRows("Config", c.columns(), "", func() error {
+		entries = append(entries, decodeConfig(c))
+		c = Config{}
+		return nil
+	})
+	return entries, err
+}
+
+// fileSizes subquery of MapKey and Size per media file, empty when columns missing
+func (db *BackupDB) fileSizes() string {
+	mapKey := db.schema.columnOr("MsgFileSegment", "MapKey", "NULL")
+	totalLen := db.schema.columnOr("MsgFileSegment", "TotalLen", "0")
+	return "SELECT " + mapKey + " AS MapKey, MAX(" + totalLen + ") AS Size FROM MsgFileSegment GROUP BY 1"
+}
+
+// Overview row counts and byte totals of backup, unknown columns count as zero
+func (db *BackupDB) Overview() (*BackupOverview, error) {
+	o := &BackupOverview{}
+	var start, end sql.NullInt64
+	if err := db.db.QueryRow("SELECT COUNT(*) FROM Name2ID").Scan(&o.Talkers); err != nil {
+		return nil, err
+	}
+	if err := db.db.QueryRow("SELECT COUNT(*) FROM Session").Scan(&o.Sessions); err != nil {
+		return nil, err
 	}
-	return files, nil
+	length := db.schema.columnOr("MsgSegments", "Length", "0")
+	startTime := db.schema.columnOr("MsgSegments", "StartTime", "NULL")
+	endTime := db.schema.columnOr("MsgSegments", "EndTime", "NULL")
+	if err := db.db.QueryRow("SELECT COUNT(*), COALESCE(SUM("+length+"), 0), MIN("+startTime+"), MAX("+endTime+") "+
+		"FROM MsgSegments").Scan(&o.Segments, &o.MessageBytes, &start, &end); err != nil {
+		return nil, err
+	}
+	mediaId := db.schema.columnOr("MsgMedia", "MediaId", "NULL")
+	if err := db.db.QueryRow("SELECT COUNT(*), COALESCE(SUM(f.Size), 0) FROM MsgMedia m "+
+		"LEFT JOIN ("+db.fileSizes()+") f ON f.MapKey = "+mediaId).Scan(&o.MediaFiles, &o.MediaBytes); err != nil {
+		return nil, err
+	}
+	o.TotalBytes = o.MessageBytes + o.MediaBytes
+	o.First, o.Last = sessionTime(start.Int64), sessionTime(end.Int64)
+	return o, nil
 }
 
 func (db *BackupDB) Close() error {
 	return db.db.Close()
 }
 
+// FindMedia lookup merged forward attachment by data id then full md5, nil if not in backup
+func (db *BackupDB) FindMedia(dataId, md5 string) (*MsgMedia, error) {
+	if dataId != "" {
+		media, err := db.MsgMedia(dataId)
+		if err == nil {
+			return media, nil
+		} else if err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
+
+	if md5 == "" || !db.schema.HasColumn("MsgMedia", "MD5") {
+		return nil, nil
+	}
+
+	cols, err := db.schema.columnNames("MsgMedia", "MD5")
+	if err != nil {
+		return nil, err
+	}
+	media, err := db.selectMedia("WHERE "+cols[0]+" = ? LIMIT 1", md5)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return media, err
+}
+
 func (db *BackupDB) MsgMedia(idStr string) (*MsgMedia, error) {
-	var msg MsgMedia
-	row := db.db.QueryRow("SELECT * FROM MsgMedia WHERE MediaIdStr = ?", idStr)
-	if row.Err() != nil {
-		return nil, row.Err()
-	}
-	if err := row.Scan(&msg.TalkerId, &msg.MediaId, &msg.MsgSegmentId,
-		&msg.SrvId, &msg.MD5, &msg.Talker, &msg.MediaIdStr,
-		&msg.Reserved0, &msg.Reserved1, &msg.Reserved2); err != nil {
+	cols, err := db.schema.columnNames("MsgMedia", "MediaIdStr")
+	if err != nil {
 		return nil, err
 	}
-	return &msg, nil
+	return db.selectMedia("WHERE "+cols[0]+" = ? LIMIT 1", idStr)
+}
+
+// selectMedia first MsgMedia match clause, sql.ErrNoRows if none
+func (db *BackupDB) selectMedia(clause string, args ...interface{}) (*MsgMedia, error) {
+	var msg *MsgMedia
+	var media MsgMedia
+	if err := db.selectRows("MsgMedia", media.columns(), clause, func() error {
+		if msg == nil {
+			m := media
+			msg = &m
+		}
+		return nil
+	}, args...); err != nil {
+		return nil, err
+	}
+	if msg == nil {
+		return nil, sql.ErrNoRows
+	}
+	return msg, nil
 }